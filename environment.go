@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// EnvAllowlist are patterns (e.g: PATH or LC_*) of env variables of the service that scripts and ${env.xxx} placeholders can access
+var EnvAllowlist []string
+
+// EnvDenylist are patterns of env variables that are never passed on - even if they are allowed on project or stage level
+var EnvDenylist []string
+
+// EnvAllowlistFile is the resource in which a project, stage or service can allow additional env variables - one pattern per line
+const EnvAllowlistFile = GenericScriptFolderBase + "env.allowlist"
+
+//
+// Returns true if the name of the env variable matches any of the patterns. Matching is case insensitive
+//
+func matchesEnvPattern(name string, patterns []string) bool {
+	name = strings.ToUpper(name)
+	for _, pattern := range patterns {
+		if matched, err := path.Match(strings.ToUpper(strings.TrimSpace(pattern)), name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// Returns true if the env variable must never be passed on because it matches the EnvDenylist
+//
+func isSensitiveEnvVariable(name string) bool {
+	return matchesEnvPattern(name, EnvDenylist)
+}
+
+//
+// Returns the env variables of the service (NAME=value) that scripts and placeholders can access:
+// those that match EnvAllowlist or the additional allowlist of the project/stage and don't match EnvDenylist
+//
+func getExposedEnvVariables(additionalAllowlist []string) []string {
+	allowlist := append(append([]string{}, EnvAllowlist...), additionalAllowlist...)
+
+	exposedEnvVariables := []string{}
+	for _, env := range os.Environ() {
+		name := strings.SplitN(env, "=", 2)[0]
+		// if the key is prefixed with 'secret_', do not handle this environment variable
+		if strings.HasPrefix(strings.ToLower(name), "secret_") {
+			continue
+		}
+		if matchesEnvPattern(name, allowlist) && !isSensitiveEnvVariable(name) {
+			exposedEnvVariables = append(exposedEnvVariables, env)
+		}
+	}
+	return exposedEnvVariables
+}
+
+//
+// Loads the additional allowlist from generic-executor/env.allowlist on service, stage or project level
+// Patterns can be separated by new lines or commas, lines starting with # are ignored
+//
+func getEnvAllowlistForProject(myKeptn *keptnv2.Keptn, uniquePrefix string) []string {
+	allowlistFile, err := getKeptnResource(myKeptn, EnvAllowlistFile, uniquePrefix)
+	if err != nil || allowlistFile == "" {
+		return []string{}
+	}
+
+	content, err := ioutil.ReadFile(allowlistFile)
+	if err != nil {
+		log.Printf("Failed to read %s: %s", allowlistFile, err.Error())
+		return []string{}
+	}
+
+	allowlist := []string{}
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		allowlist = append(allowlist, splitAndTrim(line, ",")...)
+	}
+
+	log.Printf("Additionally allowed env variables: %v", allowlist)
+	return allowlist
+}
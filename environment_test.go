@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_getExposedEnvVariables(t *testing.T) {
+	os.Setenv("GE_TEST_TENANT", "abc.live.dynatrace.com")
+	os.Setenv("GE_TEST_API_TOKEN", "my-token")
+	os.Setenv("GE_TEST_OTHER", "other")
+	defer os.Unsetenv("GE_TEST_TENANT")
+	defer os.Unsetenv("GE_TEST_API_TOKEN")
+	defer os.Unsetenv("GE_TEST_OTHER")
+
+	EnvAllowlist = []string{"GE_TEST_TENANT"}
+	EnvDenylist = []string{"*TOKEN*"}
+	defer func() { EnvAllowlist, EnvDenylist = nil, nil }()
+
+	tests := []struct {
+		name                string
+		additionalAllowlist []string
+		want                []string
+	}{
+		{name: "global allowlist", additionalAllowlist: nil, want: []string{"GE_TEST_TENANT=abc.live.dynatrace.com"}},
+		{name: "project allowlist", additionalAllowlist: []string{"ge_test_o*"}, want: []string{"GE_TEST_TENANT=abc.live.dynatrace.com", "GE_TEST_OTHER=other"}},
+		{name: "denylist wins", additionalAllowlist: []string{"GE_TEST_*"}, want: []string{"GE_TEST_TENANT=abc.live.dynatrace.com", "GE_TEST_OTHER=other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]bool{}
+			for _, env := range getExposedEnvVariables(tt.additionalAllowlist) {
+				if strings.HasPrefix(env, "GE_TEST_") {
+					got[env] = true
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("getExposedEnvVariables() = %v, want %v", got, tt.want)
+			}
+			for _, env := range tt.want {
+				if !got[env] {
+					t.Errorf("getExposedEnvVariables() is missing %s", env)
+				}
+			}
+		})
+	}
+}
@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
@@ -16,6 +21,16 @@ import (
 // GenericScriptFolderBase Folder in the Keptn GitHub Repo where we expect scripts and http files
 const GenericScriptFolderBase = "generic-executor/"
 
+const (
+	// ExecutionModeFirst only executes the first script found for an event name
+	ExecutionModeFirst = "first"
+	// ExecutionModeAll executes all scripts found for an event on service, stage and project level and sends one finished event for them
+	ExecutionModeAll = "all"
+)
+
+// ExecutionMode is the default mode - projects can set their own in generic-executor.yaml
+var ExecutionMode = ExecutionModeFirst
+
 type FinishedEventPayload struct {
 	eventData map[string]interface{}
 }
@@ -33,7 +48,15 @@ func (f *FinishedEventPayload) GetService() string {
 }
 
 func (f *FinishedEventPayload) GetLabels() map[string]string {
-	if f.eventData["labels"] == nil {
+	// labels decoded from JSON are a map[string]interface{}
+	if decodedLabels, ok := f.eventData["labels"].(map[string]interface{}); ok {
+		labels := map[string]string{}
+		for key, value := range decodedLabels {
+			labels[key] = fmt.Sprintf("%v", value)
+		}
+		f.SetLabels(labels)
+	}
+	if _, ok := f.eventData["labels"].(map[string]string); !ok {
 		f.SetLabels(map[string]string{})
 	}
 	return f.eventData["labels"].(map[string]string)
@@ -55,15 +78,18 @@ func (f *FinishedEventPayload) SetLabels(l map[string]string) {
 	f.eventData["labels"] = l
 }
 
-func findAndStoreScriptFile(myKeptn *keptnv2.Keptn, filePrefix string, uniquePrefix string) (string, error) {
+// MarshalJSON sends all properties of the payload - not only project, stage, service and labels
+func (f *FinishedEventPayload) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.eventData)
+}
+
+func findAndStoreScriptFile(myKeptn *keptnv2.Keptn, filePrefix string, extensions []string, uniquePrefix string) (scriptAction, error) {
 	// we allow different files to be specified by the end user - we first look for the more specific ones that include the file name
-	allowedFilenames := []string{
-		GenericScriptFolderBase + filePrefix + ".sh",
-		GenericScriptFolderBase + filePrefix + ".py",
-		GenericScriptFolderBase + filePrefix + ".http",
-		GenericScriptFolderBase + "all.events.sh",
-		GenericScriptFolderBase + "all.events.py",
-		GenericScriptFolderBase + "all.events.http",
+	allowedFilenames := []string{}
+	for _, name := range []string{filePrefix, "all.events"} {
+		for _, extension := range extensions {
+			allowedFilenames = append(allowedFilenames, GenericScriptFolderBase+name+extension)
+		}
 	}
 
 	// iterate over all files in that order
@@ -73,13 +99,103 @@ func findAndStoreScriptFile(myKeptn *keptnv2.Keptn, filePrefix string, uniquePre
 		if resourceFilename != "" && err == nil {
 			log.Printf("Found script %s and stored it as %s", filename, resourceFilename)
 
-			return resourceFilename, nil
+			return newScriptAction(filename, resourceFilename), nil
 		} else {
 			log.Printf("%s not found: %s", filename, err.Error())
 		}
 	}
 
-	return "", fmt.Errorf("No file found")
+	return scriptAction{}, fmt.Errorf("No file found")
+}
+
+//
+// Returns the scripts to execute for the event names, e.g: test.triggered
+// If generic-executor.yaml lists any of the event names its actions are used - otherwise the script is found via the file name conventions, see findAndStoreScriptFile
+// Also returns the execution mode: ExecutionMode or the mode specified in generic-executor.yaml
+//
+func findScriptActions(myKeptn *keptnv2.Keptn, eventNames []string, incomingEvent cloudevents.Event, serviceEnvVariables []string, uniquePrefix string) ([]scriptAction, string, error) {
+	mode := ExecutionMode
+	manifest, found, err := loadExecutorManifest(myKeptn, uniquePrefix)
+	if err != nil {
+		return nil, mode, err
+	}
+	if found && manifest.Mode != "" {
+		mode = manifest.Mode
+	}
+
+	actions, listed := []scriptAction{}, false
+	if found {
+		actions, listed, err = getManifestScriptActions(myKeptn, manifest, eventNames, incomingEvent, serviceEnvVariables, uniquePrefix)
+		if err != nil {
+			return nil, mode, err
+		}
+		if !listed {
+			log.Printf("%s doesn't list %v - looking for scripts by name", ManifestFile, eventNames)
+		}
+	}
+
+	// we look for scripts with all extensions we have an interpreter for - and without extension for scripts with a shebang line
+	extensions := getScriptExtensions(manifest.Interpreters)
+	if !listed && mode == ExecutionModeAll {
+		actions = findAllScriptActions(myKeptn, eventNames, extensions, uniquePrefix)
+	} else if !listed {
+		for _, eventName := range eventNames {
+			// Check if a suitable script/... exists
+			action, err := findAndStoreScriptFile(myKeptn, eventName, extensions, uniquePrefix)
+			if err != nil {
+				// not found -> ignore this event
+				log.Printf("Ignoring event %s as no suitable file was found", eventName)
+				continue
+			}
+			actions = append(actions, action)
+		}
+	}
+
+	// interpreters the project registered in generic-executor.yaml win over INTERPRETERS
+	projectInterpreters := normalizeInterpreters(manifest.Interpreters)
+	for ix, action := range actions {
+		if command, ok := projectInterpreters[strings.ToLower(filepath.Ext(action.file))]; ok && len(action.interpreter) == 0 {
+			actions[ix].interpreter = strings.Fields(command)
+		}
+	}
+	return actions, mode, nil
+}
+
+//
+// Returns all scripts for the event names and all.events with any extension on service, stage and project level
+// Order: more specific event names first, then by extension (see getScriptExtensions) and level (service, stage, project)
+//
+func findAllScriptActions(myKeptn *keptnv2.Keptn, eventNames []string, extensions []string, uniquePrefix string) []scriptAction {
+	actions := []scriptAction{}
+	for _, eventName := range append(append([]string{}, eventNames...), "all.events") {
+		for _, extension := range extensions {
+			filename := GenericScriptFolderBase + eventName + extension
+			for _, level := range resourceLevels {
+				resourceFilename, err := getKeptnResourceFromLevel(myKeptn, filename, level, uniquePrefix)
+				if err != nil || resourceFilename == "" {
+					continue
+				}
+				log.Printf("Found script %s on %s level and stored it as %s", filename, level, resourceFilename)
+
+				action := newScriptAction(filename, resourceFilename)
+				action.level = level
+				actions = append(actions, action)
+			}
+		}
+	}
+	return actions
+}
+
+// scriptResult is the outcome of executing a script or .http file
+type scriptResult struct {
+	// output of the script or the responses of the requests - the message of the finished event
+	output string
+	// responseJSON contains the properties for the finished event, e.g: the content of ID.finished.event.json
+	responseJSON string
+	result       keptnv2.ResultType
+	status       keptnv2.StatusType
+	// command is how the script ended - nil for .http files
+	command *commandResult
 }
 
 /**
@@ -88,91 +204,232 @@ func findAndStoreScriptFile(myKeptn *keptnv2.Keptn, filePrefix string, uniquePre
  * If onlyFirstMatch==true this method will stop after it has found the first matching filename. Otherwise it will continue finding more matches. This would for instance allow executing multiple scripts such as mypspecialscript.ph and all.events.sh
  * When calling a bashscript the args are passed as arguments to that script
  * Parameters
- * @bashfilename: filenames that the service tries to locate. This can either be shell scripts python scripts or anything else that is executable in the container
- * @httpFilenames: filenames of http scripts
- * @args: List of command line argumetns passed to the bashfiles
+ * @action: the script or http file to execute with its interpreter, args, env and timeout - see scriptAction
+ * @ctx: cancelled when the service shuts down - running scripts get killed and running requests aborted
+ * @serviceEnvVariables: env variables of the service that the script or ${env.xxx} placeholders can access
  * @executeIfExists: if true and a script is found it will be executed - otherwise it just returns EXECUTESTATUS_ACTIONFOUND
  * @onlyFirstMatch: if true will only execute the first matching script - otherwise it will keep looking for more matches
  *
  * Return:
- * string: return payload
- * string: content of ID.finished.event.json if it was written
+ * scriptResult: output, content of ID.finished.event.json if it was written, result, status and - for scripts - stdout, stderr and exit code
  * error: any error that may have occured
  */
 // if any of the passed files exist either executes the bash or the http request
 // The return status depends on the success of the executed script or HTTP Request. If the script fails or if the HTTP call returns a status code >= 300 the call is considered failed
 //
-func executeScriptOrHTTP(scriptFileName string, incomingEvent cloudevents.Event) (string, string, keptnv2.ResultType, keptnv2.StatusType, error) {
+func executeScriptOrHTTP(ctx context.Context, action scriptAction, incomingEvent cloudevents.Event, serviceEnvVariables []string) (scriptResult, error) {
+	scriptFileName := action.file
 
-	if strings.HasSuffix(scriptFileName, ".http") {
+	if isHttpFile(scriptFileName) {
 		// Execute HTTP Test
-		parsedRequest, err := parseHttpRequestFromHttpTextFile(scriptFileName, incomingEvent)
+		parsedRequests, err := parseHttpRequestsFromHttpTextFile(scriptFileName, incomingEvent, serviceEnvVariables)
 
 		if err != nil {
-			return "", "", keptnv2.ResultFailed, keptnv2.StatusErrored, fmt.Errorf("Failed to parse %s: %s", scriptFileName, err.Error())
+			outcome := scriptResult{result: keptnv2.ResultFailed, status: keptnv2.StatusErrored}
+			if unresolvedErr, ok := err.(*unresolvedPlaceholdersError); ok {
+				// the finished event lists the placeholders the event has no value for
+				unresolvedJSON, _ := json.Marshal(map[string][]string{"unresolvedPlaceholders": unresolvedErr.placeholders})
+				outcome.responseJSON = string(unresolvedJSON)
+			}
+			return outcome, fmt.Errorf("Failed to parse %s: %s", scriptFileName, err.Error())
 		}
 
-		statusCode, body, requestError := executeGenericHttpRequest(parsedRequest)
+		results := executeGenericHttpRequests(ctx, parsedRequests)
 
-		if requestError != nil {
+		if len(results) > 1 {
+			// multiple requests separated by ### - we report the result of each request
+			output, resultsJSON, result, status, err := summarizeHttpRequestResults(results)
+			return scriptResult{output: output, responseJSON: resultsJSON, result: result, status: status}, err
+		}
+
+		if results[0].err != nil {
 			// request errored
-			return "", "", keptnv2.ResultFailed, keptnv2.StatusErrored, requestError
+			return scriptResult{result: keptnv2.ResultFailed, status: keptnv2.StatusErrored}, results[0].err
 		}
-		if statusCode >= 200 && statusCode <= 299 {
-			// http status 2xx is suggesting that everything is fine
-			return body, "", keptnv2.ResultPass, keptnv2.StatusSucceeded, nil
+
+		// captured values replace the body as properties for the finished event
+		capturesJSON := ""
+		if len(parsedRequests[0].captures) > 0 {
+			capturesAsBytes, err := json.Marshal(results[0].captures)
+			if err != nil {
+				return scriptResult{output: results[0].Body, result: keptnv2.ResultFailed, status: keptnv2.StatusErrored}, err
+			}
+			capturesJSON = string(capturesAsBytes)
 		}
 
-		// last but not least: status code != 2xx suggests that something went wrong on the other side
-		log.Printf("HTTP Call returned status code %d", statusCode)
-		return body, "", keptnv2.ResultFailed, keptnv2.StatusSucceeded, nil
+		// the result depends on the assertions - by default a http status 2xx is suggesting that everything is fine
+		return scriptResult{output: results[0].Body, responseJSON: capturesJSON, result: results[0].Result, status: keptnv2.StatusSucceeded}, nil
 	}
 	// else: execute the script using bash or python
 
-	// store event in file
-	eventJSONFileName, err := storeCloudEventInFile(incomingEvent)
+	// store event in file next to the script output
+	eventJSONFileName, err := storeCloudEventInFile(incomingEvent, action.directory)
 
 	if err != nil {
-		return "", "", keptnv2.ResultFailed, keptnv2.StatusErrored, err
+		return scriptResult{result: keptnv2.ResultFailed, status: keptnv2.StatusErrored}, err
 	}
 	defer os.Remove(eventJSONFileName)
 
+	// the script runs in action.directory - so it needs absolute paths to find itself and the event
+	var directory *string
+	if action.directory != "" {
+		directory = &action.directory
+		if scriptFileName, err = filepath.Abs(scriptFileName); err == nil {
+			eventJSONFileName, err = filepath.Abs(eventJSONFileName)
+		}
+		if err != nil {
+			return scriptResult{result: keptnv2.ResultFailed, status: keptnv2.StatusErrored}, err
+		}
+	}
+
 	var executable string
 	var argsToUse []string
 
-	// check if script ends with .py
-	if strings.HasSuffix(scriptFileName, ".py") {
-		executable = "python3"
-		argsToUse = []string{scriptFileName, eventJSONFileName}
-	} else if strings.HasSuffix(scriptFileName, ".sh") {
-		executable = "bash"
-		argsToUse = []string{scriptFileName, eventJSONFileName}
-	} else {
-		// invalid filename found
-		return "", "", keptnv2.ResultFailed, keptnv2.StatusErrored, fmt.Errorf("Unhandled extension for file %s", scriptFileName)
+	// an interpreter specified in generic-executor.yaml wins - otherwise we check the extension, e.g: python3 for .py, and finally the shebang line
+	interpreter := action.interpreter
+	if len(interpreter) == 0 {
+		interpreter, err = getInterpreter(scriptFileName, nil)
+		if err != nil {
+			// invalid filename found
+			return scriptResult{result: keptnv2.ResultFailed, status: keptnv2.StatusErrored}, err
+		}
 	}
+	executable = interpreter[0]
+	argsToUse = append(append([]string{}, interpreter[1:]...), scriptFileName, eventJSONFileName)
+	argsToUse = append(argsToUse, action.args...)
 
-	// Lets execute it
-	output, err := executeCommandWithKeptnContext(executable, argsToUse, incomingEvent, nil)
+	// secrets requested via # @secret are passed as SECRET_NAME_KEY env variables
+	secretNames, err := getScriptSecretNames(scriptFileName)
+	if err != nil {
+		return scriptResult{result: keptnv2.ResultFailed, status: keptnv2.StatusErrored}, err
+	}
+	secretEnvVars, err := getSecretEnvVariables(secretNames, newSecretScope(incomingEvent))
+	if err != nil {
+		return scriptResult{result: keptnv2.ResultFailed, status: keptnv2.StatusErrored}, fmt.Errorf("Failed to load secrets for %s: %s", scriptFileName, err.Error())
+	}
+
+	// env variables specified in generic-executor.yaml are passed in addition - sorted so that scripts always see the same order
+	envNames := []string{}
+	for name := range action.env {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
+	for _, name := range envNames {
+		secretEnvVars = append(secretEnvVars, name+"="+action.env[name])
+	}
+
+	// progress the script reports via ::keptn-status:: lines or KEPTN_STATUS_FILE is sent as status.changed event
+	var outputWatcher io.Writer
+	if action.reportStatus != nil {
+		reporter := newStatusReporter(action.reportStatus)
+		defer reporter.close()
+
+		// every script gets its own status file so that it doesn't report the status of the script before it, e.g: with EXECUTION_MODE=all
+		statusFile, err := ioutil.TempFile(filepath.Dir(eventJSONFileName), fmt.Sprintf("%s.*.status", incomingEvent.ID()))
+		if err != nil {
+			return scriptResult{result: keptnv2.ResultFailed, status: keptnv2.StatusErrored}, err
+		}
+		statusFile.Close()
+		defer os.Remove(statusFile.Name())
+
+		secretEnvVars = append(secretEnvVars, "KEPTN_STATUS_FILE="+statusFile.Name())
+		defer watchStatusFile(statusFile.Name(), reporter)()
+
+		statusMarkerWriter := newStatusMarkerWriter(reporter)
+		defer statusMarkerWriter.flush()
+		outputWatcher = statusMarkerWriter
+	}
+
+	// with EXECUTION_MODE=all the scripts of an event share their directory - so a script must not get the finished event of the one before
+	if err := os.Remove(getFinishedEventFileName(incomingEvent, action.directory)); err != nil && !os.IsNotExist(err) {
+		return scriptResult{result: keptnv2.ResultFailed, status: keptnv2.StatusErrored}, err
+	}
 
+	// Lets execute it - either with the timeout specified in generic-executor.yaml, in the script or the default one
+	commandResult, err := executeCommandWithKeptnContext(ctx, executable, argsToUse, incomingEvent, serviceEnvVariables, secretEnvVars, directory, action.timeout, outputWatcher)
+
+	if _, isTimeout := err.(*scriptTimeoutError); isTimeout || ctx.Err() != nil || commandResult.ExitCode < 0 {
+		// the script didn't finish - so we can't say anything about its result
+		return scriptResult{output: commandResult.Stdout, result: keptnv2.ResultFailed, status: keptnv2.StatusErrored, command: &commandResult}, err
+	}
+
+	// lets see if the script wrote a file called ID.finished.event.json in its directory - also if it failed
+	finishedEvent, _ := loadCloudEventFinishedFromFile(incomingEvent, action.directory)
+	outcome := scriptResult{output: commandResult.Stdout, responseJSON: finishedEvent, command: &commandResult}
+
+	// the exit code decides about result and status, e.g: 2=warning - unless the script set them explicitly in its finished event JSON
+	exitCodeOutcome := action.exitCodes.lookup(commandResult.ExitCode)
+	outcome.result, outcome.status = exitCodeOutcome.result, exitCodeOutcome.status
+	responseJSONAsString := outcome.responseJSON
+	if responseJSONAsString == "" {
+		responseJSONAsString = outcome.output
+	}
+	responseJSON, _ := HandleResponsePayload(responseJSONAsString)
+	explicitResult, explicitStatus := takeResultOverrides(responseJSON)
+	if explicitResult != "" {
+		outcome.result = explicitResult
+	}
+	if explicitStatus != "" {
+		outcome.status = explicitStatus
+	}
+
+	if explicitResult == "" && outcome.result == keptnv2.ResultFailed {
+		if err == nil {
+			err = fmt.Errorf("%s exited with exit code %d", scriptFileName, commandResult.ExitCode)
+		}
+		return outcome, err
+	}
 	if err != nil {
-		// return a failed result
-		return output, "", keptnv2.ResultFailed, keptnv2.StatusSucceeded, err
+		log.Printf("%s exited with exit code %d which means %s, %s", scriptFileName, commandResult.ExitCode, outcome.result, outcome.status)
 	}
+	return outcome, nil
+}
 
-	// lets see if the script wrote a file called
-	finishedEvent, _ := loadCloudEventFinishedFromFile(incomingEvent)
+/**
+ * Combines the results of multiple requests of a .http file
+ * The output contains the response of every request. The returned JSON contains the captured values and the list of results which will end up in the finished event
+ * The result is the worst result of all requests, the status is errored as soon as one request couldn't be sent
+ */
+func summarizeHttpRequestResults(results []httpRequestResult) (string, string, keptnv2.ResultType, keptnv2.StatusType, error) {
+	result := keptnv2.ResultPass
+	status := keptnv2.StatusSucceeded
+	output := ""
+	for _, requestResult := range results {
+		if requestResult.Skipped {
+			output += fmt.Sprintf("[%s] %s %s: skipped\n", requestResult.Name, requestResult.Method, requestResult.URI)
+			continue
+		}
+		if requestResult.err != nil {
+			status = keptnv2.StatusErrored
+			output += fmt.Sprintf("[%s] %s %s: %s\n", requestResult.Name, requestResult.Method, requestResult.URI, requestResult.Message)
+		} else {
+			output += fmt.Sprintf("[%s] %s %s: %d\n%s\n", requestResult.Name, requestResult.Method, requestResult.URI, requestResult.StatusCode, requestResult.Body)
+		}
+		result = worseResult(result, requestResult.Result)
+	}
 
-	return output, finishedEvent, keptnv2.ResultPass, keptnv2.StatusSucceeded, nil
+	// values captured by later requests overwrite the ones of earlier requests
+	properties := map[string]interface{}{}
+	for _, requestResult := range results {
+		for name, value := range requestResult.captures {
+			properties[name] = value
+		}
+	}
+	properties["requests"] = results
+
+	resultsJSON, err := json.Marshal(properties)
+	if err != nil {
+		return output, "", keptnv2.ResultFailed, keptnv2.StatusErrored, err
+	}
+
+	return output, string(resultsJSON), result, status, nil
 }
 
 /**
  * Validates whether a file with the format ID.finished.event.json exists - if so - loads it
  */
-func loadCloudEventFinishedFromFile(incomingEvent cloudevents.Event) (string, error) {
-	eventJSONFileName := fmt.Sprintf("%s.finished.event.json", incomingEvent.ID())
-
-	content, err := ioutil.ReadFile(eventJSONFileName)
+func loadCloudEventFinishedFromFile(incomingEvent cloudevents.Event, directory string) (string, error) {
+	content, err := ioutil.ReadFile(getFinishedEventFileName(incomingEvent, directory))
 	if err != nil {
 		return "", err
 	}
@@ -181,12 +438,19 @@ func loadCloudEventFinishedFromFile(incomingEvent cloudevents.Event) (string, er
 }
 
 /**
- * stores the cloud event to a local file with ID.event.json
+ * Returns the file a script can write its finished event JSON to: ID.finished.event.json in directory
+ */
+func getFinishedEventFileName(incomingEvent cloudevents.Event, directory string) string {
+	return filepath.Join(directory, fmt.Sprintf("%s.finished.event.json", incomingEvent.ID()))
+}
+
+/**
+ * stores the cloud event to a local file with ID.event.json in directory
  */
-func storeCloudEventInFile(incomingEvent cloudevents.Event) (string, error) {
+func storeCloudEventInFile(incomingEvent cloudevents.Event, directory string) (string, error) {
 	// First - lets store the event as a json file on the filesystem as we are passing it to the script as an argument
 
-	eventJSONFileName := fmt.Sprintf("%s.event.json", incomingEvent.ID())
+	eventJSONFileName := filepath.Join(directory, fmt.Sprintf("%s.event.json", incomingEvent.ID()))
 
 	// marshal incomingEvent
 	dataAsJSON, err := json.Marshal(incomingEvent)
@@ -197,10 +461,15 @@ func storeCloudEventInFile(incomingEvent cloudevents.Event) (string, error) {
 	}
 
 	file, err := os.Create(eventJSONFileName)
-
-	file.Write(dataAsJSON)
+	if err != nil {
+		return "", err
+	}
 	defer file.Close()
 
+	if _, err := file.Write(dataAsJSON); err != nil {
+		return "", err
+	}
+
 	return eventJSONFileName, nil
 }
 
@@ -227,7 +496,8 @@ func HandleResponsePayload(responsePayload string) (map[string]interface{}, erro
 }
 
 // GenericCloudEventsHandler handles all cloud-events by looking up a script-file and executing it
-func GenericCloudEventsHandler(myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data interface{}) error {
+// Once ctx is cancelled running scripts and requests are stopped and the finished event is sent with status errored
+func GenericCloudEventsHandler(ctx context.Context, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data interface{}) error {
 	log.Printf("Handling %s Event: %s", incomingEvent.Type(), incomingEvent.Context.GetID())
 	log.Printf("CloudEvent %T: %v", data, data)
 
@@ -260,8 +530,15 @@ func GenericCloudEventsHandler(myKeptn *keptnv2.Keptn, incomingEvent cloudevents
 	// by default we always check for taskName.statusType, e.g: test.triggered
 	eventNamesToExecute = append(eventNamesToExecute, fmt.Sprintf("%s.%s", taskName, statusType))
 
+	// every event gets its own workspace for the fetched resources and everything the scripts write - it's removed once we are done
+	eventWorkspace, err := newWorkspace(incomingEvent.Context.GetID())
+	if err != nil {
+		return fmt.Errorf("Failed to create workspace: %s", err.Error())
+	}
+	defer eventWorkspace.remove()
+
 	// prefix for storing filenames
-	uniquePrefix := incomingEvent.Context.GetID()
+	uniquePrefix := eventWorkspace.directory
 
 	// if this is a triggered event we will be sending out start & finished events - otherwise not as we assume we just handle these events for notification purposes
 	sendStartFinishedEvents := true
@@ -271,18 +548,58 @@ func GenericCloudEventsHandler(myKeptn *keptnv2.Keptn, incomingEvent cloudevents
 		log.Printf("Not sending start/finished event as %s is not a triggered event!", incomingEvent.Type())
 	}
 
-	// now we iterate through all eventName we want to look for scripts for
-	for _, eventName := range eventNamesToExecute {
+	// only allowed env variables of our service are passed to scripts - the project, stage or service can allow additional ones
+	serviceEnvVariables := getExposedEnvVariables(getEnvAllowlistForProject(myKeptn, uniquePrefix))
 
-		// Check if a suitable script/... exists; exit if not
-		scriptFileName, err := findAndStoreScriptFile(myKeptn, eventName, uniquePrefix)
+	// find the scripts - either via generic-executor.yaml or the file name conventions
+	actions, mode, err := findScriptActions(myKeptn, eventNamesToExecute, incomingEvent, serviceEnvVariables, uniquePrefix)
+	if err != nil {
+		log.Printf("Failed to find scripts: %s", err.Error())
+		eventWorkspace.recordResult(keptnv2.ResultFailed, keptnv2.StatusErrored)
+		if sendStartFinishedEvents {
+			// the project wants us to handle this event but we can't - so we let Keptn know
+			myKeptn.SendTaskStartedEvent(&keptnv2.EventData{}, ServiceName)
+			sendTaskFinishedEvent(myKeptn, &keptnv2.EventData{
+				Status:  keptnv2.StatusErrored,
+				Result:  keptnv2.ResultFailed,
+				Message: err.Error(),
+			})
+		}
+		return err
+	}
 
+	// scripts run in a directory with all files of generic-executor/ so that they can use files next to them, e.g: source ./lib.sh
+	needsScriptDirectory := false
+	for _, action := range actions {
+		needsScriptDirectory = needsScriptDirectory || !isHttpFile(action.file)
+	}
+	if needsScriptDirectory {
+		scriptDirectory, err := materializeScriptDirectory(myKeptn, uniquePrefix)
 		if err != nil {
-			// not found -> ignore this event
-			log.Printf("Ignoring event %s as no suitable file was found", eventName)
-			continue
-			// return err
+			// scripts that don't need other files still work in the workspace
+			log.Printf("Failed to store %s: %s", GenericScriptFolderBase, err.Error())
+			scriptDirectory = eventWorkspace.directory
+		}
+		for ix := range actions {
+			actions[ix].directory = scriptDirectory
 		}
+	}
+
+	// scripts can report their progress which we pass on as status.changed events
+	if sendStartFinishedEvents {
+		for ix := range actions {
+			actions[ix].reportStatus = newStatusChangedEventSender(myKeptn, actions[ix].name)
+		}
+	}
+
+	if mode == ExecutionModeAll {
+		// one started and one finished event for all scripts
+		return executeAllScriptActions(ctx, myKeptn, taskName, actions, incomingEvent, serviceEnvVariables, eventWorkspace, sendStartFinishedEvents)
+	}
+
+	// now we iterate through all scripts we found
+	for _, action := range actions {
+		scriptFileName := action.name
 
 		// Script exists -> Send task.started event in case we are handling a triggered event
 		if sendStartFinishedEvents {
@@ -298,77 +615,260 @@ func GenericCloudEventsHandler(myKeptn *keptnv2.Keptn, incomingEvent cloudevents
 
 		// Finally Executing the Script
 		log.Printf("Executing %s", scriptFileName)
-		response, responseJSONAsString, result, status, err := executeScriptOrHTTP(scriptFileName, incomingEvent)
+		executionStart := time.Now()
+		outcome, err := executeScriptOrHTTP(ctx, action, incomingEvent, serviceEnvVariables)
+		observeScriptExecution(action, outcome.result, outcome.status, time.Since(executionStart))
+		eventWorkspace.recordResult(outcome.result, outcome.status)
 
+		execution := newScriptExecution(action, outcome, time.Since(executionStart))
+		var properties map[string]interface{}
 		if err != nil {
-
 			log.Printf("Script execution failed: %s", err.Error())
-
-			if sendStartFinishedEvents {
-				// script execution failed - send finished event
-				_, err = myKeptn.SendTaskFinishedEvent(&keptnv2.EventData{
-					Status:  status,
-					Result:  result,
-					Message: fmt.Sprintf("Failed to execute %s: %s", scriptFileName, err.Error()),
-				}, ServiceName)
-			}
-
-			return err
+			execution.Message = fmt.Sprintf("Failed to execute %s: %s", scriptFileName, err.Error())
 		} else {
-			log.Printf("Script execution successful: %s, %s", result, status)
+			log.Printf("Script execution successful: %s, %s", outcome.result, outcome.status)
 			if VerboseLogging {
-				log.Printf(response)
+				log.Print(outcome.output)
 			}
+			execution.Message = executionMessage(action, outcome)
 		}
 
+		// parse the response - first check if there was a written file with a JSON response - if not see if the console output is a valid JSON
+		// properties are also passed on if the script failed, e.g: a link to the report of failed tests
+		properties = parseResponseProperties(outcome)
+
 		if sendStartFinishedEvents {
-			// finally send a task.finished event
-			responseCloudEvent := &keptnv2.EventData{
-				Status:  status,
-				Result:  result,
-				Message: response,
+			// finally send a task.finished event - stdout, stderr and exit code of the script are always part of it
+			properties["execution"] = execution
+			propertiesJSON, marshalErr := json.Marshal(properties)
+			if marshalErr != nil {
+				return handleError(myKeptn, marshalErr)
 			}
 
-			// parse the response - first check if there was a written file with a JSON response
-			var responseJSON map[string]interface{}
-			if responseJSONAsString != "" {
-				responseJSON, _ = HandleResponsePayload(responseJSONAsString)
-			} else {
-				// if not see if the console output is a valid JSON
-				responseJSON, _ = HandleResponsePayload(response)
+			responseCloudEvent := &keptnv2.EventData{
+				Status:  outcome.status,
+				Result:  outcome.result,
+				Message: execution.Message,
+			}
+			if err := sendTaskFinishedEventWithResponse(myKeptn, taskName, responseCloudEvent, string(propertiesJSON)); err != nil {
+				return err
 			}
+		}
 
-			if responseJSON == nil || err != nil {
-				// failed to parse response payload so we assume this is just regular response
-				if err != nil {
-					log.Printf("Couldn't parse the response as JSON Payload. Considering it normal response: %s", err.Error())
-				} else {
-					log.Printf("Response was not JSON - so - we consider it a normal response!")
-				}
-				_, err = myKeptn.SendTaskFinishedEvent(responseCloudEvent, ServiceName)
-			} else {
-				// TODO - need @florianbacher to look at this code
-				// convert the event to a map[string]interface{} to set the result of the operation as a property of the outgoing event
-				responseEventMap := map[string]interface{}{}
-				if err := keptnv2.Decode(responseCloudEvent, &responseEventMap); err != nil {
-					return handleError(myKeptn, err)
-				}
+		if err != nil {
+			return err
+		}
 
-				payload := &FinishedEventPayload{eventData: responseEventMap}
-				if responseJSON != nil {
-					log.Printf("Script returned JSON properties for finished event: %v", responseJSON)
-					// set the responseJSON to e.g: "test" when handling the test task
-					responseEventMap[taskName] = responseJSON
-				}
+	} // actions
+
+	log.Printf("Done executing scripts!")
+
+	return nil
+}
+
+//
+// Returns a function that sends the progress a script reports as status.changed event
+//
+func newStatusChangedEventSender(myKeptn *keptnv2.Keptn, scriptName string) func(message string) {
+	return func(message string) {
+		log.Printf("Status of %s: %s", scriptName, message)
+		_, err := sendTaskStatusChangedEvent(myKeptn, &keptnv2.EventData{
+			Message: fmt.Sprintf("[%s] %s", scriptName, message),
+		})
+		if err != nil {
+			log.Printf("Failed to send task.status.changed event: %s", err.Error())
+		}
+	}
+}
+
+// scriptExecution is the outcome of one script as it is reported in the finished event
+type scriptExecution struct {
+	Script  string             `json:"script"`
+	Level   string             `json:"level,omitempty"`
+	Result  keptnv2.ResultType `json:"result"`
+	Status  keptnv2.StatusType `json:"status"`
+	Message string             `json:"message,omitempty"`
+	// Stdout, Stderr and ExitCode are only set for scripts - not for .http files
+	Stdout   string `json:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Duration string `json:"duration"`
+}
+
+//
+// Returns the scriptExecution of an action for the finished event. The message is left to the caller
+//
+func newScriptExecution(action scriptAction, outcome scriptResult, duration time.Duration) scriptExecution {
+	execution := scriptExecution{
+		Script:   action.name,
+		Level:    action.level,
+		Result:   outcome.result,
+		Status:   outcome.status,
+		Duration: formatCommandDuration(duration),
+	}
+	if outcome.command != nil {
+		execution.Stdout = outcome.command.Stdout
+		execution.Stderr = outcome.command.Stderr
+		exitCode := outcome.command.ExitCode
+		execution.ExitCode = &exitCode
+		execution.Duration = outcome.command.Duration
+	}
+	return execution
+}
+
+//
+// Returns the message of the finished event for an action that was executed. The response of a .http file is its message
+// Scripts only get a summary - their output is already part of the execution and would otherwise make the event several times as big
+//
+func executionMessage(action scriptAction, outcome scriptResult) string {
+	if outcome.command == nil {
+		return outcome.output
+	}
+	return fmt.Sprintf("%s finished with result %s and exit code %d", action.name, outcome.result, outcome.command.ExitCode)
+}
+
+//
+// Returns the properties a script or .http file returned for the finished event: the JSON of ID.finished.event.json or the requests - or the output if it is JSON
+//
+func parseResponseProperties(outcome scriptResult) map[string]interface{} {
+	responseJSONAsString := outcome.responseJSON
+	if responseJSONAsString == "" {
+		responseJSONAsString = outcome.output
+	}
 
-				_, err = myKeptn.SendTaskFinishedEvent(payload, ServiceName)
+	properties := map[string]interface{}{}
+	responseJSON, err := HandleResponsePayload(responseJSONAsString)
+	if err != nil {
+		log.Printf("Couldn't parse the response as JSON Payload. Considering it normal response: %s", err.Error())
+	}
+	for key, value := range responseJSON {
+		properties[key] = value
+	}
+	if outcome.command != nil {
+		// result and status a script sets explicitly aren't properties - see takeResultOverrides
+		takeResultOverrides(properties)
+	}
+	return properties
+}
+
+/**
+ * Executes all actions in order and sends a single started and finished event for them
+ * The finished event contains the output of all scripts, the worst result, status errored if any script errored,
+ * the JSON properties returned by the scripts (later scripts overwrite earlier ones) and the list of executions
+ */
+func executeAllScriptActions(ctx context.Context, myKeptn *keptnv2.Keptn, taskName string, actions []scriptAction, incomingEvent cloudevents.Event, serviceEnvVariables []string, eventWorkspace *workspace, sendStartFinishedEvents bool) error {
+	if len(actions) == 0 {
+		log.Printf("Done executing scripts!")
+		return nil
+	}
+
+	scriptNames := []string{}
+	for _, action := range actions {
+		scriptNames = append(scriptNames, action.name)
+	}
+
+	if sendStartFinishedEvents {
+		_, err := myKeptn.SendTaskStartedEvent(&keptnv2.EventData{
+			Message: fmt.Sprintf("Found scripts %s", strings.Join(scriptNames, ", ")),
+		}, ServiceName)
+
+		if err != nil {
+			log.Printf("Failed to send task.started event: %s", err.Error())
+			return err
+		}
+	}
+
+	result := keptnv2.ResultPass
+	status := keptnv2.StatusSucceeded
+	output := ""
+	properties := map[string]interface{}{}
+	executions := []scriptExecution{}
+	for _, action := range actions {
+		log.Printf("Executing %s", action.name)
+		executionStart := time.Now()
+		outcome, err := executeScriptOrHTTP(ctx, action, incomingEvent, serviceEnvVariables)
+		actionResult, actionStatus, response := outcome.result, outcome.status, outcome.output
+		observeScriptExecution(action, actionResult, actionStatus, time.Since(executionStart))
+		eventWorkspace.recordResult(actionResult, actionStatus)
+
+		execution := newScriptExecution(action, outcome, time.Since(executionStart))
+		if err != nil {
+			log.Printf("Script execution failed: %s", err.Error())
+			execution.Message = fmt.Sprintf("Failed to execute %s: %s", action.name, err.Error())
+			response = execution.Message
+		} else {
+			log.Printf("Script execution successful: %s, %s", actionResult, actionStatus)
+			if outcome.command != nil {
+				execution.Message = executionMessage(action, outcome)
+				response = execution.Message
 			}
 		}
+		for key, value := range parseResponseProperties(outcome) {
+			properties[key] = value
+		}
+		executions = append(executions, execution)
 
-	} // eventNamesToExecute
+		result = worseResult(result, actionResult)
+		if actionStatus == keptnv2.StatusErrored {
+			status = keptnv2.StatusErrored
+		}
+		output += fmt.Sprintf("[%s] %s\n%s\n", action.name, actionResult, response)
+	}
+	properties["executions"] = executions
 
-	log.Printf("Done executing scripts!")
+	if VerboseLogging {
+		log.Print(output)
+	}
+	log.Printf("Done executing scripts: %s, %s", result, status)
+
+	if !sendStartFinishedEvents {
+		return nil
+	}
+
+	propertiesJSON, err := json.Marshal(properties)
+	if err != nil {
+		return handleError(myKeptn, err)
+	}
+
+	return sendTaskFinishedEventWithResponse(myKeptn, taskName, &keptnv2.EventData{
+		Status:  status,
+		Result:  result,
+		Message: output,
+	}, string(propertiesJSON))
+}
 
+/**
+ * Sends the task.finished event. If the response is a JSON object its properties are set under the task name, e.g: "test"
+ */
+func sendTaskFinishedEventWithResponse(myKeptn *keptnv2.Keptn, taskName string, responseCloudEvent *keptnv2.EventData, responseJSONAsString string) error {
+	responseJSON, err := HandleResponsePayload(responseJSONAsString)
+
+	if responseJSON == nil || err != nil {
+		// failed to parse response payload so we assume this is just regular response
+		if err != nil {
+			log.Printf("Couldn't parse the response as JSON Payload. Considering it normal response: %s", err.Error())
+		} else {
+			log.Printf("Response was not JSON - so - we consider it a normal response!")
+		}
+		if _, err := sendTaskFinishedEvent(myKeptn, responseCloudEvent); err != nil {
+			log.Printf("Failed to send task.finished event: %s", err.Error())
+		}
+		return nil
+	}
+
+	// convert the event to a map[string]interface{} to set the result of the operation as a property of the outgoing event
+	responseEventMap := map[string]interface{}{}
+	if err := keptnv2.Decode(responseCloudEvent, &responseEventMap); err != nil {
+		return handleError(myKeptn, err)
+	}
+
+	log.Printf("Script returned JSON properties for finished event: %v", responseJSON)
+	// set the responseJSON to e.g: "test" when handling the test task
+	responseEventMap[taskName] = responseJSON
+
+	if _, err := sendTaskFinishedEvent(myKeptn, &FinishedEventPayload{eventData: responseEventMap}); err != nil {
+		log.Printf("Failed to send task.finished event: %s", err.Error())
+	}
 	return nil
 }
 
@@ -376,11 +876,11 @@ func handleError(myKeptn *keptnv2.Keptn, err error) error {
 
 	log.Printf("handleError: %s", err.Error())
 
-	_, err = myKeptn.SendTaskFinishedEvent(&keptnv2.EventData{
+	_, err = sendTaskFinishedEvent(myKeptn, &keptnv2.EventData{
 		Status:  keptnv2.StatusSucceeded,
 		Result:  keptnv2.ResultWarning,
 		Message: fmt.Sprintf("Failed to parse response: %s", err.Error()),
-	}, ServiceName)
+	})
 
 	return err
 }
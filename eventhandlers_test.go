@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func Test_findScriptActionsExecutionMode(t *testing.T) {
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop", "stage": "dev", "service": "carts"})
+	myKeptn, err := keptnv2.NewKeptn(&event, keptn.KeptnOpts{UseLocalFileSystem: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { ExecutionMode = ExecutionModeFirst }()
+
+	tests := []struct {
+		name string
+		mode string
+		want []string
+	}{
+		{
+			name: "first",
+			mode: ExecutionModeFirst,
+			want: []string{"generic-executor/test.triggered.sh"},
+		},
+		{
+			name: "all",
+			mode: ExecutionModeAll,
+			want: []string{
+				"generic-executor/test.triggered.sh",
+				"generic-executor/test.triggered.http",
+				"generic-executor/all.events.sh",
+				"generic-executor/all.events.http",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ExecutionMode = tt.mode
+			actions, mode, err := findScriptActions(myKeptn, []string{"test.triggered"}, event, []string{}, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mode != tt.mode {
+				t.Errorf("findScriptActions() mode = %s, want %s", mode, tt.mode)
+			}
+			got := []string{}
+			for _, action := range actions {
+				got = append(got, action.name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findScriptActions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_executeScriptsInSameDirectory(t *testing.T) {
+	directory, err := ioutil.TempDir("", "generic-executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	// with EXECUTION_MODE=all both scripts run in the same directory - b.sh writes no finished event
+	scripts := map[string]string{
+		"a.sh": "echo '{\"result\": \"warning\", \"x\": 1}' > \"$ID.finished.event.json\"\n",
+		"b.sh": "echo done\n",
+	}
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop"})
+
+	tests := []struct {
+		script       string
+		wantResult   keptnv2.ResultType
+		wantResponse string
+	}{
+		{script: "a.sh", wantResult: keptnv2.ResultWarning, wantResponse: "{\"result\": \"warning\", \"x\": 1}\n"},
+		{script: "b.sh", wantResult: keptnv2.ResultPass, wantResponse: ""},
+	}
+	for _, tt := range tests {
+		fileName := filepath.Join(directory, tt.script)
+		if err := ioutil.WriteFile(fileName, []byte(scripts[tt.script]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		action := newScriptAction("generic-executor/"+tt.script, fileName)
+		action.directory = directory
+
+		outcome, err := executeScriptOrHTTP(context.Background(), action, event, []string{"PATH=" + os.Getenv("PATH")})
+		if err != nil {
+			t.Fatalf("executeScriptOrHTTP(%s) error = %v", tt.script, err)
+		}
+		if outcome.result != tt.wantResult || outcome.responseJSON != tt.wantResponse {
+			t.Errorf("executeScriptOrHTTP(%s) = %s %q, want %s %q", tt.script, outcome.result, outcome.responseJSON, tt.wantResult, tt.wantResponse)
+		}
+	}
+}
+
+func Test_executionMessage(t *testing.T) {
+	action := scriptAction{name: "generic-executor/test.triggered.sh"}
+	tests := []struct {
+		name    string
+		outcome scriptResult
+		want    string
+	}{
+		{
+			name:    "script",
+			outcome: scriptResult{output: "lots of output", result: keptnv2.ResultWarning, command: &commandResult{Stdout: "lots of output", ExitCode: 2}},
+			want:    "generic-executor/test.triggered.sh finished with result warning and exit code 2",
+		},
+		{
+			name:    "http",
+			outcome: scriptResult{output: "response body", result: keptnv2.ResultPass},
+			want:    "response body",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := executionMessage(action, tt.outcome); got != tt.want {
+				t.Errorf("executionMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
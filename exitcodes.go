@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// defaultExitCode is the key of the mapping that applies to all exit codes that aren't listed explicitly
+const defaultExitCode = "*"
+
+// exitCodeOutcome is the result and status a script reports to Keptn by exiting with a certain exit code
+type exitCodeOutcome struct {
+	result keptnv2.ResultType
+	status keptnv2.StatusType
+}
+
+// exitCodeMapping maps exit codes of scripts to results and status, e.g: 0=pass,2=warning,3=fail/errored,*=fail
+type exitCodeMapping map[string]exitCodeOutcome
+
+// ExitCodeMapping is the default mapping of exit codes of all scripts. Can be extended via EXIT_CODE_MAPPING, # @exit-codes or exitCodes in generic-executor.yaml
+var ExitCodeMapping = exitCodeMapping{
+	"0":             {result: keptnv2.ResultPass, status: keptnv2.StatusSucceeded},
+	defaultExitCode: {result: keptnv2.ResultFailed, status: keptnv2.StatusSucceeded},
+}
+
+//
+// Parses exit codes and what they mean, e.g: 0=pass,2=warning,3=fail/errored,*=fail. The status defaults to succeeded
+//
+func parseExitCodeMapping(value string) (exitCodeMapping, error) {
+	mapping := exitCodeMapping{}
+	for _, entry := range splitAndTrim(value, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid exit code mapping %s: must be <exit code>=<result>[/<status>]", entry)
+		}
+		exitCode := strings.TrimSpace(parts[0])
+		if _, err := strconv.Atoi(exitCode); err != nil && exitCode != defaultExitCode {
+			return nil, fmt.Errorf("Invalid exit code %s: must be a number or %s", exitCode, defaultExitCode)
+		}
+
+		outcome := exitCodeOutcome{status: keptnv2.StatusSucceeded}
+		resultAndStatus := strings.SplitN(parts[1], "/", 2)
+		result, ok := parseResultType(resultAndStatus[0])
+		if !ok {
+			return nil, fmt.Errorf("Invalid result %s for exit code %s: must be pass, warning or fail", strings.TrimSpace(resultAndStatus[0]), exitCode)
+		}
+		outcome.result = result
+		if len(resultAndStatus) == 2 {
+			status, ok := parseStatusType(resultAndStatus[1])
+			if !ok {
+				return nil, fmt.Errorf("Invalid status %s for exit code %s: must be succeeded or errored", strings.TrimSpace(resultAndStatus[1]), exitCode)
+			}
+			outcome.status = status
+		}
+		mapping[exitCode] = outcome
+	}
+	return mapping, nil
+}
+
+//
+// Returns a copy of the mapping with the entries of overrides added or replaced
+//
+func (m exitCodeMapping) merge(overrides exitCodeMapping) exitCodeMapping {
+	merged := exitCodeMapping{}
+	for _, mapping := range []exitCodeMapping{m, overrides} {
+		for exitCode, outcome := range mapping {
+			merged[exitCode] = outcome
+		}
+	}
+	return merged
+}
+
+//
+// Returns the result and status for an exit code. Exit codes that aren't mapped fail - unless the mapping has a default
+//
+func (m exitCodeMapping) lookup(exitCode int) exitCodeOutcome {
+	if outcome, ok := m[strconv.Itoa(exitCode)]; ok {
+		return outcome
+	}
+	if outcome, ok := m[defaultExitCode]; ok {
+		return outcome
+	}
+	if exitCode == 0 {
+		return exitCodeOutcome{result: keptnv2.ResultPass, status: keptnv2.StatusSucceeded}
+	}
+	return exitCodeOutcome{result: keptnv2.ResultFailed, status: keptnv2.StatusSucceeded}
+}
+
+//
+// Formats the mapping as it is configured, e.g: 0=pass,2=warning,*=fail/errored
+//
+func (m exitCodeMapping) String() string {
+	entries := []string{}
+	for exitCode, outcome := range m {
+		entry := exitCode + "=" + string(outcome.result)
+		if outcome.status != keptnv2.StatusSucceeded {
+			entry += "/" + string(outcome.status)
+		}
+		entries = append(entries, entry)
+	}
+	// * sorts before the digits - but it reads better at the end
+	sort.Slice(entries, func(i, j int) bool {
+		if strings.HasPrefix(entries[i], defaultExitCode) != strings.HasPrefix(entries[j], defaultExitCode) {
+			return strings.HasPrefix(entries[j], defaultExitCode)
+		}
+		return entries[i] < entries[j]
+	})
+	return strings.Join(entries, ",")
+}
+
+//
+// Returns the exit code mapping for a script: ExitCodeMapping extended by the one specified via "# @exit-codes" in the script
+//
+func getScriptExitCodes(scriptFileName string) exitCodeMapping {
+	content, err := ioutil.ReadFile(scriptFileName)
+	if err != nil {
+		return ExitCodeMapping
+	}
+
+	exitCodesDirective, ok := parseScriptDirectives(string(content))["exit-codes"]
+	if !ok {
+		return ExitCodeMapping
+	}
+
+	mapping, err := parseExitCodeMapping(exitCodesDirective)
+	if err != nil {
+		log.Printf("Invalid exit codes '%s' in %s - using default of %s: %s", exitCodesDirective, scriptFileName, ExitCodeMapping.String(), err.Error())
+		return ExitCodeMapping
+	}
+	return ExitCodeMapping.merge(mapping)
+}
+
+func parseResultType(value string) (keptnv2.ResultType, bool) {
+	switch result := keptnv2.ResultType(strings.ToLower(strings.TrimSpace(value))); result {
+	case keptnv2.ResultPass, keptnv2.ResultWarning, keptnv2.ResultFailed:
+		return result, true
+	}
+	return "", false
+}
+
+func parseStatusType(value string) (keptnv2.StatusType, bool) {
+	switch status := keptnv2.StatusType(strings.ToLower(strings.TrimSpace(value))); status {
+	case keptnv2.StatusSucceeded, keptnv2.StatusErrored:
+		return status, true
+	}
+	return "", false
+}
+
+//
+// Returns the result and status a script set explicitly in the JSON of its finished event, e.g: {"result": "warning", "status": "succeeded"}
+// They are removed from properties as they are fields of the finished event and not properties of the task
+//
+func takeResultOverrides(properties map[string]interface{}) (keptnv2.ResultType, keptnv2.StatusType) {
+	var result keptnv2.ResultType
+	var status keptnv2.StatusType
+	if value, ok := properties["result"].(string); ok {
+		if parsed, ok := parseResultType(value); ok {
+			result = parsed
+			delete(properties, "result")
+		}
+	}
+	if value, ok := properties["status"].(string); ok {
+		if parsed, ok := parseStatusType(value); ok {
+			status = parsed
+			delete(properties, "status")
+		}
+	}
+	return result, status
+}
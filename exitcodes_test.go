@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func Test_parseExitCodeMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "results", value: "0=pass, 2=warning,*=fail", want: "0=pass,2=warning,*=fail"},
+		{name: "status", value: "3=fail/errored,4=Warning/Succeeded", want: "3=fail/errored,4=warning"},
+		{name: "empty", value: "", want: ""},
+		{name: "missing result", value: "2", wantErr: true},
+		{name: "invalid exit code", value: "two=warning", wantErr: true},
+		{name: "invalid result", value: "2=ok", wantErr: true},
+		{name: "invalid status", value: "2=fail/unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseExitCodeMapping(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExitCodeMapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("parseExitCodeMapping() = %s, want %s", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func Test_executeScriptExitCodes(t *testing.T) {
+	directory, err := ioutil.TempDir("", "generic-executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	tests := []struct {
+		name       string
+		script     string
+		wantResult keptnv2.ResultType
+		wantStatus keptnv2.StatusType
+		wantErr    bool
+	}{
+		{name: "success", script: "exit 0", wantResult: keptnv2.ResultPass, wantStatus: keptnv2.StatusSucceeded},
+		{name: "unmapped exit code", script: "exit 1", wantResult: keptnv2.ResultFailed, wantStatus: keptnv2.StatusSucceeded, wantErr: true},
+		{name: "warning", script: "# @exit-codes 2=warning\nexit 2", wantResult: keptnv2.ResultWarning, wantStatus: keptnv2.StatusSucceeded},
+		{name: "errored", script: "# @exit-codes 3=fail/errored\nexit 3", wantResult: keptnv2.ResultFailed, wantStatus: keptnv2.StatusErrored, wantErr: true},
+		{name: "result from JSON", script: `echo '{"result": "warning", "report": "link"}'`, wantResult: keptnv2.ResultWarning, wantStatus: keptnv2.StatusSucceeded},
+		{name: "JSON wins over exit code", script: `echo '{"result": "pass", "status": "errored"}'; exit 1`, wantResult: keptnv2.ResultPass, wantStatus: keptnv2.StatusErrored},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scriptFileName := filepath.Join(directory, "test.triggered.sh")
+			if err := ioutil.WriteFile(scriptFileName, []byte(tt.script), 0644); err != nil {
+				t.Fatal(err)
+			}
+			action := newScriptAction("generic-executor/test.triggered.sh", scriptFileName)
+			action.directory = directory
+
+			event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop"})
+			outcome, err := executeScriptOrHTTP(context.Background(), action, event, []string{"PATH=" + os.Getenv("PATH")})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("executeScriptOrHTTP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if outcome.result != tt.wantResult || outcome.status != tt.wantStatus {
+				t.Errorf("executeScriptOrHTTP() = %s, %s, want %s, %s", outcome.result, outcome.status, tt.wantResult, tt.wantStatus)
+			}
+			if properties := parseResponseProperties(outcome); properties["result"] != nil || properties["status"] != nil {
+				t.Errorf("parseResponseProperties() = %v, result and status must not be properties", properties)
+			}
+		})
+	}
+}
@@ -6,4 +6,6 @@ require (
 	github.com/cloudevents/sdk-go/v2 v2.3.1
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/keptn/go-utils v0.8.0
+	github.com/prometheus/client_golang v1.9.0
+	gopkg.in/yaml.v2 v2.4.0
 )
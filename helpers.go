@@ -2,25 +2,108 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	"github.com/keptn/go-utils/pkg/api/models"
+	keptnapi "github.com/keptn/go-utils/pkg/api/utils"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 )
 
+// ScriptTimeout is the default time a script may run before its process group gets killed. 0 means no timeout
+var ScriptTimeout time.Duration
+
+// processKillGracePeriod is how long we wait for a killed process group to release its output pipes
+const processKillGracePeriod = 5 * time.Second
+
+// scriptDirectivePattern matches directives in comment lines of scripts, e.g: # @timeout 5m
+var scriptDirectivePattern = regexp.MustCompile(`^\s*(?:#|//)\s*@([a-zA-Z][\w-]*)\s*(.*?)\s*$`)
+
+// scriptTimeoutError is returned when a script didn't finish within its timeout and got killed
+type scriptTimeoutError struct {
+	command string
+	timeout time.Duration
+}
+
+func (e *scriptTimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s and was killed", e.command, e.timeout.String())
+}
+
+// HttpTimeout is the default timeout of a single HTTP request sent for a .http file. 0 means no timeout
+var HttpTimeout time.Duration
+
+// HttpRetries is the default number of retries for a failed HTTP request
+var HttpRetries int
+
+// HttpRetryOn is the default list of status codes that trigger a retry, e.g: 502, 503 or 5xx
+var HttpRetryOn []string
+
+// HttpRetryBackoff is the default delay before the first retry - it doubles with every further retry
+var HttpRetryBackoff time.Duration
+
+// errNoHttpRequest is returned when a .http file or a block in it doesn't contain a request
+var errNoHttpRequest = errors.New("No HTTP Method or URI Found")
+
+// httpVersionPattern matches the optional HTTP version at the end of a request line, e.g: HTTP/1.1
+var httpVersionPattern = regexp.MustCompile(`^HTTP/\d(\.\d)?$`)
+
 type genericHttpRequest struct {
-	method  string
-	uri     string
-	headers map[string]string
-	body    string
+	name       string
+	method     string
+	uri        string
+	version    string
+	headers    http.Header
+	body       string
+	options    httpRequestOptions
+	assertions []httpAssertion
+	captures   []httpCapture
+}
+
+// genericHttpResponse is the response of a genericHttpRequest
+type genericHttpResponse struct {
+	statusCode int
+	headers    http.Header
+	body       string
+	latency    time.Duration
+}
+
+// httpRequestOptions control how a genericHttpRequest is sent. They can be set via directives in the .http file, e.g: # @retries 3
+type httpRequestOptions struct {
+	timeout      time.Duration
+	retries      int
+	retryOn      []string
+	retryBackoff time.Duration
+	// if false, the remaining requests of a .http file are skipped when this one fails
+	continueOnFailure bool
+}
+
+// httpRequestResult is the outcome of one request of a .http file as it is reported in the finished event
+type httpRequestResult struct {
+	Name       string                `json:"name"`
+	Method     string                `json:"method"`
+	URI        string                `json:"uri"`
+	StatusCode int                   `json:"statusCode,omitempty"`
+	Result     keptnv2.ResultType    `json:"result,omitempty"`
+	Message    string                `json:"message,omitempty"`
+	Body       string                `json:"body,omitempty"`
+	Latency    string                `json:"latency,omitempty"`
+	Assertions []httpAssertionResult `json:"assertions,omitempty"`
+	Skipped    bool                  `json:"skipped,omitempty"`
+	captures   map[string]interface{}
+	err        error
 }
 
 /**
@@ -37,12 +120,13 @@ func removeFiles(filesToRemove []string) {
 	}
 }
 
+// resourceLevels are the levels of the Keptn configuration repo in the order in which resources are looked up
+var resourceLevels = []string{"service", "stage", "project"}
+
 /**
  * Retrieves a resource (=file) from the keptn configuration repo and returns its content
  */
 func getKeptnResource(myKeptn *keptnv2.Keptn, resource string, uniquePrefix string) (string, error) {
-	resourceHandler := myKeptn.ResourceHandler
-
 	// local filesystem?
 	if myKeptn.UseLocalFileSystem {
 		if _, err := os.Stat(resource); err == nil {
@@ -52,31 +136,98 @@ func getKeptnResource(myKeptn *keptnv2.Keptn, resource string, uniquePrefix stri
 		}
 	}
 
-	// SERVICE-LEVEL: lets try to find it on service level
-	requestedResource, err := resourceHandler.GetServiceResource(myKeptn.Event.GetProject(), myKeptn.Event.GetStage(), myKeptn.Event.GetService(), resource)
+	// SERVICE-LEVEL first, then one level up on STAGE-LEVEL and finally on PROJECT-LEVEL
+	var err error
+	for _, level := range resourceLevels {
+		var content string
+		content, err = fetchKeptnResource(myKeptn, resource, level)
+		if err == nil {
+			myKeptn.Logger.Debug("Found " + resource + " on " + level + " level")
 
-	if err != nil || requestedResource.ResourceContent == "" {
-		// STAGE-LEVEL: not found on service level - lets search one level up on stage level
-		requestedResource, err = resourceHandler.GetStageResource(myKeptn.Event.GetProject(), myKeptn.Event.GetStage(), resource)
-		if err != nil || requestedResource.ResourceContent == "" {
-			// PROJECT-LEVEL: not found on the stage level - lets search one level up on project level
-			requestedResource, err = resourceHandler.GetProjectResource(myKeptn.Event.GetProject(), resource)
+			// now store that file on the same directory structure locally
+			return storeKeptnResource(fmt.Sprintf("%s/%s", uniquePrefix, resource), content)
+		}
+	}
 
-			if err != nil || requestedResource.ResourceContent == "" {
-				return "", err
-			}
+	return "", err
+}
 
-			myKeptn.Logger.Debug("Found " + resource + " on project level")
-		} else {
-			myKeptn.Logger.Debug("Found " + resource + " on stage level")
+/**
+ * Retrieves a resource from one level (service, stage or project) of the keptn configuration repo and stores it as uniquePrefix/level/resource
+ * Unlike getKeptnResource this allows to get the same resource from multiple levels
+ */
+func getKeptnResourceFromLevel(myKeptn *keptnv2.Keptn, resource string, level string, uniquePrefix string) (string, error) {
+	// local filesystem only knows one level
+	if myKeptn.UseLocalFileSystem {
+		if level != resourceLevels[0] {
+			return "", fmt.Errorf("%s not found on %s level", resource, level)
+		}
+		return getKeptnResource(myKeptn, resource, uniquePrefix)
+	}
+
+	content, err := fetchKeptnResource(myKeptn, resource, level)
+	if err != nil {
+		return "", err
+	}
+	return storeKeptnResource(fmt.Sprintf("%s/%s/%s", uniquePrefix, level, resource), content)
+}
+
+/**
+ * Returns the content of a resource on service, stage or project level. Returns an error if it doesn't exist or is empty
+ * Resources and negative lookups are cached for RESOURCE_CACHE_TTL - see resourceCache
+ */
+func fetchKeptnResource(myKeptn *keptnv2.Keptn, resource string, level string) (string, error) {
+	resourceHandler := myKeptn.ResourceHandler
+	project, stage, service := myKeptn.Event.GetProject(), myKeptn.Event.GetStage(), myKeptn.Event.GetService()
+
+	cacheKey := resourceCacheKey(project, stage, service, level, resource)
+	if cached, ok := keptnResourceCache.get(cacheKey); ok {
+		observeResourceCacheLookup(true)
+		if !cached.found {
+			return "", fmt.Errorf("%s not found on %s level", resource, level)
 		}
-	} else {
-		myKeptn.Logger.Debug("Found " + resource + " on service level")
+		return cached.content, nil
 	}
+	observeResourceCacheLookup(false)
+
+	start := time.Now()
+	var requestedResource *models.Resource
+	var err error
+	switch level {
+	case "service":
+		requestedResource, err = resourceHandler.GetServiceResource(project, stage, service, resource)
+	case "stage":
+		requestedResource, err = resourceHandler.GetStageResource(project, stage, resource)
+	case "project":
+		requestedResource, err = resourceHandler.GetProjectResource(project, resource)
+	default:
+		return "", fmt.Errorf("Unknown level %s", level)
+	}
+
+	found := err == nil && requestedResource != nil && requestedResource.ResourceContent != ""
+	observeResourceFetch(level, found, start)
 
-	targetFileName := fmt.Sprintf("%s/%s", uniquePrefix, resource)
+	if err == keptnapi.ResourceNotFoundError {
+		// negative lookups are cached too - most events don't have a script on every level
+		keptnResourceCache.put(cacheKey, "", false)
+	}
+	if err != nil {
+		return "", err
+	}
+	if requestedResource != nil && requestedResource.Metadata != nil {
+		keptnResourceCache.observeVersion(project, requestedResource.Metadata.Branch, requestedResource.Metadata.Version)
+	}
+	keptnResourceCache.put(cacheKey, requestedResource.ResourceContent, found)
+	if !found {
+		return "", fmt.Errorf("%s not found on %s level", resource, level)
+	}
+	return requestedResource.ResourceContent, nil
+}
 
-	// now store that file on the same directory structure locally
+/**
+ * Stores the content of a resource locally, e.g: as EVENTID/generic-executor/test.triggered.sh
+ */
+func storeKeptnResource(targetFileName string, content string) (string, error) {
 	os.RemoveAll(targetFileName)
 	pathArr := strings.Split(targetFileName, "/")
 	directory := ""
@@ -85,22 +236,20 @@ func getKeptnResource(myKeptn *keptnv2.Keptn, resource string, uniquePrefix stri
 	}
 
 	if directory != "" {
-		err = os.MkdirAll(directory, os.ModePerm)
+		err := os.MkdirAll(directory, os.ModePerm)
 		if err != nil {
 			return "", err
 		}
 	}
 	resourceFile, err := os.Create(targetFileName)
 	if err != nil {
-		fmt.Errorf(err.Error())
 		return "", err
 	}
 	defer resourceFile.Close()
 
-	_, err = resourceFile.Write([]byte(requestedResource.ResourceContent))
+	_, err = resourceFile.Write([]byte(content))
 
 	if err != nil {
-		fmt.Errorf(err.Error())
 		return "", err
 	}
 
@@ -120,10 +269,11 @@ func getKeptnResource(myKeptn *keptnv2.Keptn, resource string, uniquePrefix stri
 // $DEPLOYMENT, $TESTSTRATEGY
 // $DEPLOYMENTURILOCAL, $DEPLOYMENTURIPUBLIC
 // $LABEL.XXXX  -> will replace that with a label called XXXX
-// $ENV.XXXX    -> will replace that with an env variable called XXXX
-// $SECRET.YYYY -> will replace that with the k8s secret called YYYY
+// $ENV.XXXX    -> will replace that with an env variable called XXXX if it is part of serviceEnvVariables
+// ${secret.YYYY.KEY} -> will be replaced with the key KEY of the k8s secret called YYYY in .http files - see httpPlaceholders
+// ${json:XXXX} -> will be replaced with the field XXXX as JSON, e.g: ${json:data.labels}
 //
-func manageKeptnPlaceholders(input string, incomingEvent cloudevents.Event) (string, []string) {
+func manageKeptnPlaceholders(input string, incomingEvent cloudevents.Event, serviceEnvVariables []string) (string, []string) {
 
 	result := input
 
@@ -143,33 +293,40 @@ func manageKeptnPlaceholders(input string, incomingEvent cloudevents.Event) (str
 	result = strings.Replace(result, "${timeutcstring}", timeutc, -1)
 	result = strings.Replace(result, "${timeutcms}", timeutcms, -1)
 
-	// First, we iterate through all our env-variables
-	// TODO: Passing our own env variables is mega dangerous, this needs to be adapted when we have proper secret management in Keptn
-	for _, env := range os.Environ() {
+	// First, we iterate through the env-variables of the service we are allowed to pass on - see getExposedEnvVariables
+	for _, env := range serviceEnvVariables {
 		pair := strings.SplitN(env, "=", 2)
-		key := strings.ToLower(pair[0])
-		// if the key is prefixed with 'secret_', do not handle this environment variable
-		if strings.HasPrefix(key, "secret_") {
+		if len(pair) < 2 {
 			continue
 		}
+		key := strings.ToLower(pair[0])
 		result = strings.Replace(result, "${env."+key+"}", pair[1], -1)
 
 		// also add the env-variable "as-is" to our list of envVariables!
 		envArray = append(envArray, env)
 
 		if VerboseLogging {
-			log.Printf(env)
+			log.Print(env)
 		}
 	}
 
 	// Second, we iterate through all data elements in our incoming event
-	myMap := map[string]interface{}{}
-	if err := keptnv2.Decode(incomingEvent, &myMap); err != nil {
+	myMap, err := decodePlaceholderFields(incomingEvent)
+	if err != nil {
 		log.Printf("Failed to decode incomingEvent: %s", err.Error())
 		return input, envArray
 	}
 	result, envArray = manageKeptnPlaceholdersRecursively(result, envArray, "", myMap)
 
+	// objects and arrays can be inserted as JSON, e.g: ${json:data.labels}
+	result = jsonPlaceholderPattern.ReplaceAllStringFunc(result, func(placeholder string) string {
+		valueAsJSON, exists, err := placeholderJSON(myMap, jsonPlaceholderPattern.FindStringSubmatch(placeholder)[1])
+		if err != nil || !exists {
+			return placeholder
+		}
+		return valueAsJSON
+	})
+
 	return result, envArray
 }
 
@@ -187,10 +344,9 @@ func manageKeptnPlaceholdersRecursively(input string, envArray []string, keyPath
 		// for env-variables we make them UPPER CASE and replace any . with _
 		newKeyPathEnvVariable := strings.ToUpper(strings.ReplaceAll(newKeyPath, ".", "_"))
 
-		switch value.(type) {
-		case string:
+		// numbers and booleans are passed in their canonical form, e.g: 1234 or true
+		if stringValue, ok := placeholderString(value); ok {
 			// First, replace it in the input string
-			stringValue := value.(string)
 			input = strings.ReplaceAll(input, newKeyPathPlaceHolder, stringValue)
 			if VerboseLogging {
 				log.Printf("%s --> %s", newKeyPathPlaceHolder, stringValue)
@@ -200,8 +356,12 @@ func manageKeptnPlaceholdersRecursively(input string, envArray []string, keyPath
 			envVariableDefinition := fmt.Sprintf("%s=%s", newKeyPathEnvVariable, stringValue)
 			envArray = append(envArray, envVariableDefinition)
 			if VerboseLogging {
-				log.Printf(envVariableDefinition)
+				log.Print(envVariableDefinition)
 			}
+			continue
+		}
+
+		switch value.(type) {
 		case map[string]interface{}:
 			input, envArray = manageKeptnPlaceholdersRecursively(input, envArray, newKeyPath, value.(map[string]interface{}))
 		case []interface{}:
@@ -223,10 +383,9 @@ func manageKeptnPlaceholdersArrayRecursively(input string, envArray []string, ke
 		// for env-variables we make them UPPER CASE and replace any . with _
 		newKeyPathEnvVariable := strings.ToUpper(fmt.Sprintf("%s_%d", strings.ReplaceAll(keyPath, ".", "_"), index))
 
-		switch value.(type) {
-		case string:
+		// numbers and booleans are passed in their canonical form, e.g: 1234 or true
+		if stringValue, ok := placeholderString(value); ok {
 			// First, replace it in the input string
-			stringValue := value.(string)
 			input = strings.ReplaceAll(input, newKeyPathPlaceHolder, stringValue)
 			if VerboseLogging {
 				log.Printf("%s --> %s", newKeyPathPlaceHolder, stringValue)
@@ -236,8 +395,12 @@ func manageKeptnPlaceholdersArrayRecursively(input string, envArray []string, ke
 			envVariableDefinition := fmt.Sprintf("%s=%s", newKeyPathEnvVariable, stringValue)
 			envArray = append(envArray, envVariableDefinition)
 			if VerboseLogging {
-				log.Printf(envVariableDefinition)
+				log.Print(envVariableDefinition)
 			}
+			continue
+		}
+
+		switch value.(type) {
 		case map[string]interface{}:
 			input, envArray = manageKeptnPlaceholdersRecursively(input, envArray, newKeyPath, value.(map[string]interface{}))
 		case []interface{}:
@@ -247,185 +410,681 @@ func manageKeptnPlaceholdersArrayRecursively(input string, envArray []string, ke
 	return input, envArray
 }
 
-func _nextCleanLine(lines []string, lineIx int, trim bool) (int, string) {
-	// sanity check
-	lineIx++
-	maxLines := len(lines)
-	if lineIx < 0 || maxLines <= 0 || lineIx >= maxLines {
-		return -1, ""
+//
+// Parses .http raw file content and returns all requests (HTTP METHOD, URI, HEADERS, BODY) in that file
+//
+func parseHttpRequestsFromHttpTextFile(httpfile string, incomingEvent cloudevents.Event, serviceEnvVariables []string) ([]genericHttpRequest, error) {
+	content, err := ioutil.ReadFile(httpfile)
+	if err != nil {
+		return nil, err
 	}
 
-	line := ""
-	for ; lineIx < maxLines; lineIx++ {
-		line = lines[lineIx]
-		if trim {
-			line = strings.Trim(line, " ")
+	// templates are rendered instead of replacing ${...} placeholders
+	isTemplate, err := isHttpTemplate(httpfile, string(content))
+	if err != nil {
+		return nil, err
+	}
+	if isTemplate {
+		policy, err := getUnresolvedPlaceholdersPolicy(string(content))
+		if err != nil {
+			return nil, err
+		}
+		rendered, err := renderHttpTemplate(filepath.Base(httpfile), string(content), incomingEvent, serviceEnvVariables, policy)
+		if err != nil {
+			return nil, err
 		}
-		if strings.HasPrefix(line, "#") {
+		return parseHttpRequests(splitHttpRequestBlocks(rendered))
+	}
+
+	return parseHttpRequestsFromString(string(content), incomingEvent, serviceEnvVariables)
+}
+
+//
+// Parses .http string content and returns all requests in it. Requests are separated by lines starting with ###
+//
+func parseHttpRequestsFromString(rawContent string, incomingEvent cloudevents.Event, serviceEnvVariables []string) ([]genericHttpRequest, error) {
+	placeholders, err := newHttpPlaceholders(incomingEvent, serviceEnvVariables)
+	if err != nil {
+		return nil, err
+	}
+	if placeholders.policy, err = getUnresolvedPlaceholdersPolicy(rawContent); err != nil {
+		return nil, err
+	}
+
+	// lets replace all Keptn related placeholders and secrets - escaped for the part of the request they are in
+	blocks := splitHttpRequestBlocks(rawContent)
+	for ix, block := range blocks {
+		if blocks[ix], err = placeholders.resolveRequest(block); err != nil {
+			return nil, err
+		}
+	}
+	if err := placeholders.checkUnresolved(); err != nil {
+		return nil, err
+	}
+
+	return parseHttpRequests(blocks)
+}
+
+//
+// Parses the requests of a .http file whose placeholders are already resolved - one request per block
+// The directives of a header before the first ### without a request are the defaults of all requests, e.g: # @timeout 10s
+//
+func parseHttpRequests(blocks []string) ([]genericHttpRequest, error) {
+	defaults := []string{}
+	if len(blocks) > 1 {
+		if _, err := parseHttpRequestFromString(blocks[0]); err == errNoHttpRequest {
+			defaults = httpDefaultDirectives(blocks[0])
+			blocks = blocks[1:]
+		}
+	}
+
+	requests := []genericHttpRequest{}
+	for _, block := range blocks {
+		request, err := parseHttpRequestFromString(withHttpDefaultDirectives(block, defaults))
+		if err == errNoHttpRequest {
+			// e.g: only comments before the first ### or after the last ###
 			continue
 		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse request %d: %s", len(requests)+1, err.Error())
+		}
 
-		// stop if we found a new line that is not a comment!
-		if len(line) >= 0 {
-			break
+		if request.name == "" {
+			request.name = fmt.Sprintf("request%d", len(requests)+1)
 		}
+		requests = append(requests, request)
 	}
 
-	// have we reached the end of the strings?
-	if lineIx >= maxLines {
-		return lineIx, ""
+	if len(requests) == 0 {
+		return nil, errNoHttpRequest
 	}
-	return lineIx, line
+	return requests, nil
 }
 
+// httpCombinedDirectives are directives whose values of the header and of a request are combined - the request doesn't replace them
+var httpCombinedDirectives = map[string]bool{"assert": true, "assert-warning": true, "capture": true}
+
 //
-// Parses .http raw file content and returns HTTP METHOD, URI, HEADERS, BODY
+// Returns the directive lines of the header of a .http file that apply to all requests. A name only applies to the request it is in
 //
-func parseHttpRequestFromHttpTextFile(httpfile string, incomingEvent cloudevents.Event) (genericHttpRequest, error) {
-	var returnRequest genericHttpRequest
+func httpDefaultDirectives(header string) []string {
+	directives := []string{}
+	for _, line := range strings.Split(header, "\n") {
+		matches := scriptDirectivePattern.FindStringSubmatch(line)
+		if matches != nil && strings.ToLower(matches[1]) != "name" {
+			directives = append(directives, strings.TrimSpace(line))
+		}
+	}
+	return directives
+}
 
-	content, err := ioutil.ReadFile(httpfile)
-	if err != nil {
-		return returnRequest, err
+//
+// Adds the default directives to a request that it doesn't specify itself. Assertions and captures of the header are added to the ones of the request
+//
+func withHttpDefaultDirectives(block string, defaults []string) string {
+	if len(defaults) == 0 {
+		return block
+	}
+	own := parseScriptDirectives(block)
+	lines := []string{}
+	for _, line := range defaults {
+		name := strings.ToLower(scriptDirectivePattern.FindStringSubmatch(line)[1])
+		if _, overwritten := own[name]; !overwritten || httpCombinedDirectives[name] {
+			lines = append(lines, line)
+		}
 	}
+	// comments before the request line are skipped when parsing the request
+	return strings.Join(append(lines, block), "\n")
+}
 
-	return parseHttpRequestFromString(string(content), incomingEvent)
+//
+// Splits the content of a .http file into the blocks separated by ### (as in IntelliJ or the VS Code REST Client)
+//
+func splitHttpRequestBlocks(rawContent string) []string {
+	blocks := []string{}
+	currentBlock := []string{}
+	for _, line := range strings.Split(rawContent, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "###") {
+			blocks = append(blocks, strings.Join(currentBlock, "\n"))
+			currentBlock = []string{}
+			continue
+		}
+		currentBlock = append(currentBlock, line)
+	}
+	return append(blocks, strings.Join(currentBlock, "\n"))
 }
 
 //
-// Parses .http string content and returns HTTP METHOD, URI, HEADERS, BODY
+// Parses a single request of a .http file and returns HTTP METHOD, URI, HEADERS, BODY
 //
-func parseHttpRequestFromString(rawContent string, incomingEvent cloudevents.Event) (genericHttpRequest, error) {
+func parseHttpRequestFromString(rawContent string) (genericHttpRequest, error) {
 	var returnRequest genericHttpRequest
 
-	// lets first replace all Keptn related placeholders
-	rawContent, _ = manageKeptnPlaceholders(rawContent, incomingEvent)
+	// timeout, retries ... are specified as directives in comments
+	directives := parseScriptDirectives(rawContent)
+	options, err := parseHttpRequestOptions(directives)
+	if err != nil {
+		return returnRequest, err
+	}
+	returnRequest.options = options
+	returnRequest.name = directives["name"]
+
+	// assertions decide whether the response is considered pass, warning or fail
+	returnRequest.assertions, err = parseHttpAssertions(rawContent)
+	if err != nil {
+		return returnRequest, err
+	}
+
+	// captures extract values from the response that are passed on in the finished event
+	returnRequest.captures, err = parseHttpCaptures(rawContent)
+	if err != nil {
+		return returnRequest, err
+	}
 
-	// lets get each line
-	lines := strings.Split(rawContent, "\n")
+	// lets get each line - files may have Windows line endings
+	lines := strings.Split(strings.Replace(rawContent, "\r\n", "\n", -1), "\n")
 
 	//
-	// lets find the first clean line - must be the HTTP Method and URI, e.g: GET http://myuri
-	lineIx, line := _nextCleanLine(lines, -1, true)
-	if lineIx < 0 {
-		return returnRequest, errors.New("No HTTP Method or URI Found")
+	// lets find the first line that is neither empty nor a comment - must be the request line, e.g: GET http://myuri HTTP/1.1
+	lineIx := 0
+	for lineIx < len(lines) && (strings.TrimSpace(lines[lineIx]) == "" || isHttpComment(lines[lineIx])) {
+		lineIx++
 	}
+	if lineIx >= len(lines) {
+		return returnRequest, errNoHttpRequest
+	}
+	returnRequest.method, returnRequest.uri, returnRequest.version, err = parseHttpRequestLine(lines[lineIx])
+	if err != nil {
+		return returnRequest, err
+	}
+	lineIx++
 
-	lineSplits := strings.Split(line, " ")
-	if len(lineSplits) == 1 {
-		// only provides URI
-		returnRequest.method = "GET"
-		returnRequest.uri = lineSplits[0]
-	} else {
-		// provides method and URI
-		returnRequest.method = lineSplits[0]
-		returnRequest.uri = lineSplits[1]
+	// long query strings can be split over multiple lines that start with ? or &
+	for ; lineIx < len(lines); lineIx++ {
+		queryLine := strings.TrimSpace(lines[lineIx])
+		if !strings.HasPrefix(queryLine, "?") && !strings.HasPrefix(queryLine, "&") {
+			break
+		}
+		returnRequest.uri += queryLine
 	}
 
 	//
 	// now lets iterate through the next lines as they should all be headers until we end up with a blank line or EOF
-	returnRequest.headers = make(map[string]string)
-	lineIx, line = _nextCleanLine(lines, lineIx, true)
-	for (lineIx > 0) && (len(line) > 0) {
-		lineSplits = strings.Split(line, ":")
-		if len(lineSplits) < 2 {
-			break
+	returnRequest.headers = http.Header{}
+	lastHeader := ""
+	for ; lineIx < len(lines) && strings.TrimSpace(lines[lineIx]) != ""; lineIx++ {
+		line := lines[lineIx]
+		if isHttpComment(line) {
+			continue
+		}
+
+		// lines starting with whitespace continue the value of the previous header
+		if line[0] == ' ' || line[0] == '\t' {
+			if lastHeader == "" {
+				return returnRequest, fmt.Errorf("Invalid header line '%s': continuation without a header", strings.TrimSpace(line))
+			}
+			values := returnRequest.headers[lastHeader]
+			values[len(values)-1] = strings.TrimSpace(values[len(values)-1] + " " + strings.TrimSpace(line))
+			continue
 		}
-		headerName := strings.Trim(lineSplits[0], " ")
-		headerValue := strings.Trim(lineSplits[1], " ")
-		returnRequest.headers[headerName] = headerValue
-		lineIx, line = _nextCleanLine(lines, lineIx, true)
+
+		// only split on the first : as values may contain more, e.g: Authorization: Bearer a:b
+		headerParts := strings.SplitN(line, ":", 2)
+		headerName := strings.TrimSpace(headerParts[0])
+		if len(headerParts) != 2 || headerName == "" {
+			return returnRequest, fmt.Errorf("Invalid header line '%s': must be <name>: <value>", strings.TrimSpace(line))
+		}
+		lastHeader = http.CanonicalHeaderKey(headerName)
+		returnRequest.headers.Add(lastHeader, strings.TrimSpace(headerParts[1]))
 	}
 
 	//
-	// if we still have content it must be the request body
+	// if we still have content it must be the request body - it ends with the block and may contain empty lines
+	bodyLines := []string{}
+	for lineIx++; lineIx < len(lines); lineIx++ {
+		// comments in the body are dropped as they always were, e.g: directives after the body
+		if strings.HasPrefix(lines[lineIx], "#") {
+			continue
+		}
+		bodyLines = append(bodyLines, lines[lineIx])
+	}
+	for len(bodyLines) > 0 && strings.TrimSpace(bodyLines[len(bodyLines)-1]) == "" {
+		bodyLines = bodyLines[:len(bodyLines)-1]
+	}
 	returnRequest.body = ""
-	lineIx, line = _nextCleanLine(lines, lineIx, false)
-	for lineIx > 0 && len(line) > 0 {
-		returnRequest.body += line
-		returnRequest.body += "\n"
-		lineIx, line = _nextCleanLine(lines, lineIx, false)
+	for _, line := range bodyLines {
+		returnRequest.body += line + "\n"
 	}
 
 	return returnRequest, nil
 }
 
+//
+// Returns true for comment lines of a .http file, e.g: # @assert status 200 or // a comment
+//
+func isHttpComment(line string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//")
+}
+
+//
+// Parses the request line of a .http file: [METHOD] URI [HTTP-VERSION], e.g: POST https://example.com/api HTTP/1.1
+// The method defaults to GET and the version to the one the client negotiates
+//
+func parseHttpRequestLine(line string) (string, string, string, error) {
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) == 1:
+		return "GET", fields[0], "", nil
+	case len(fields) == 2 && httpVersionPattern.MatchString(fields[1]):
+		return "GET", fields[0], fields[1], nil
+	case len(fields) == 2:
+		return fields[0], fields[1], "", nil
+	case len(fields) == 3 && httpVersionPattern.MatchString(fields[2]):
+		return fields[0], fields[1], fields[2], nil
+	default:
+		return "", "", "", fmt.Errorf("Invalid request line '%s': must be [METHOD] URI [HTTP/VERSION]", strings.TrimSpace(line))
+	}
+}
+
+//
+// Returns the options for sending a request based on the directives in a .http file, e.g: # @timeout 10s, # @retries 3, # @retry-on 502,503, # @retry-backoff 2s or # @on-failure continue
+// Options that are not specified default to HttpTimeout, HttpRetries, HttpRetryOn and HttpRetryBackoff
+//
+func parseHttpRequestOptions(directives map[string]string) (httpRequestOptions, error) {
+	options := httpRequestOptions{
+		timeout:      HttpTimeout,
+		retries:      HttpRetries,
+		retryOn:      HttpRetryOn,
+		retryBackoff: HttpRetryBackoff,
+	}
+
+	var err error
+	if value, ok := directives["timeout"]; ok {
+		if options.timeout, err = time.ParseDuration(value); err != nil {
+			return options, fmt.Errorf("Invalid @timeout %s: %s", value, err.Error())
+		}
+	}
+	if value, ok := directives["retries"]; ok {
+		if options.retries, err = strconv.Atoi(value); err != nil || options.retries < 0 {
+			return options, fmt.Errorf("Invalid @retries %s: must be a number >= 0", value)
+		}
+	}
+	if value, ok := directives["retry-on"]; ok {
+		options.retryOn = splitAndTrim(value, ",")
+	}
+	if value, ok := directives["retry-backoff"]; ok {
+		if options.retryBackoff, err = time.ParseDuration(value); err != nil {
+			return options, fmt.Errorf("Invalid @retry-backoff %s: %s", value, err.Error())
+		}
+	}
+	if value, ok := directives["on-failure"]; ok {
+		switch strings.ToLower(value) {
+		case "continue":
+			options.continueOnFailure = true
+		case "stop":
+			options.continueOnFailure = false
+		default:
+			return options, fmt.Errorf("Invalid @on-failure %s: must be continue or stop", value)
+		}
+	}
+
+	return options, nil
+}
+
+//
+// Splits a string by the separator and removes whitespaces and empty elements, e.g: "502, 503," -> [502 503]
+//
+func splitAndTrim(value string, separator string) []string {
+	result := []string{}
+	for _, item := range strings.Split(value, separator) {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+//
+// Checks whether a status code matches any of the patterns which are either a status code (502) or a class of status codes (5xx)
+//
+func matchesStatusCode(statusCode int, patterns []string) bool {
+	statusCodeString := strconv.Itoa(statusCode)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == statusCodeString {
+			return true
+		}
+		if len(pattern) == 3 && strings.HasSuffix(pattern, "xx") && len(statusCodeString) == 3 && pattern[0] == statusCodeString[0] {
+			return true
+		}
+	}
+	return false
+}
+
 //
 // Sends a generic HTTP Request
+// Failed requests and requests that return one of the retryOn status codes are retried with an exponential backoff
+// Once ctx is cancelled, e.g: when the service shuts down, the request is aborted and no further retries are sent
+//
+func executeGenericHttpRequest(ctx context.Context, request genericHttpRequest) (genericHttpResponse, error) {
+	client := http.Client{Timeout: request.options.timeout}
+
+	var response genericHttpResponse
+	var err error
+	for attempt := 0; attempt <= request.options.retries; attempt++ {
+		if attempt > 0 {
+			// 1x, 2x, 4x ... the backoff
+			delay := request.options.retryBackoff * time.Duration(1<<uint(attempt-1))
+			log.Printf("Retrying %s %s in %s (retry %d of %d)", request.method, request.uri, delay.String(), attempt, request.options.retries)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return response, fmt.Errorf("%s %s was cancelled: %s", request.method, request.uri, ctx.Err().Error())
+			}
+		}
+
+		response, err = sendGenericHttpRequest(ctx, client, request)
+		if err != nil {
+			log.Printf("HTTP request failed: %s", err.Error())
+			continue
+		}
+		if !matchesStatusCode(response.statusCode, request.options.retryOn) {
+			break
+		}
+		log.Printf("HTTP request returned status code %d", response.statusCode)
+	}
+
+	return response, err
+}
+
+//
+// Sends all requests of a .http file in order. If a request fails, the remaining ones are skipped unless it specifies # @on-failure continue
+// A request fails if it can't be sent or if one of its assertions fails. Without a status assertion a request fails if it doesn't return a 2xx status code
+//
+func executeGenericHttpRequests(ctx context.Context, requests []genericHttpRequest) []httpRequestResult {
+	results := []httpRequestResult{}
+	stopped := false
+	for _, request := range requests {
+		// the URI ends up in the finished event - it may contain a secret, e.g: in a query string
+		result := httpRequestResult{Name: request.name, Method: request.method, URI: secretRedactor.redact(request.uri)}
+		if stopped {
+			result.Skipped = true
+			result.Message = "Skipped as a previous request failed"
+			results = append(results, result)
+			continue
+		}
+
+		response, err := executeGenericHttpRequest(ctx, request)
+		result.StatusCode = response.statusCode
+		result.Body = response.body
+		if err != nil {
+			result.Result = keptnv2.ResultFailed
+			result.Message = err.Error()
+			result.err = err
+		} else {
+			result.Latency = response.latency.String()
+			result.Result, result.Assertions = evaluateHttpAssertions(request.assertions, response)
+			result.captures = evaluateHttpCaptures(request.captures, response)
+			if result.Result != keptnv2.ResultPass {
+				log.Printf("HTTP Call %s returned status code %d and result %s", request.name, response.statusCode, result.Result)
+			}
+		}
+		results = append(results, result)
+
+		if result.Result == keptnv2.ResultFailed && !request.options.continueOnFailure {
+			stopped = true
+		}
+	}
+	return results
+}
+
+//
+// Sends a single attempt of a generic HTTP Request
 //
-func executeGenericHttpRequest(request genericHttpRequest) (int, string, error) {
-	client := http.Client{}
+func sendGenericHttpRequest(ctx context.Context, client http.Client, request genericHttpRequest) (genericHttpResponse, error) {
+	var response genericHttpResponse
 
 	// define the request
-	log.Println(request.method, request.uri, request.uri, request.body)
-	req, err := http.NewRequest(request.method, request.uri, bytes.NewBufferString(request.body))
+	log.Println(request.method, request.uri)
+	if VerboseLogging {
+		log.Println(request.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, request.method, request.uri, bytes.NewBufferString(request.body))
 
 	if err != nil {
-		return -1, "", err
+		return response, err
 	}
 
-	// add the headers
-	for key, value := range request.headers {
-		req.Header.Add(key, value)
+	// add the headers - a header may be repeated, e.g: multiple Cookie or Accept headers
+	for key, values := range request.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	// Go sends the Host header from req.Host and ignores it in req.Header
+	if host := request.headers.Get("Host"); host != "" {
+		req.Host = host
 	}
 
 	// execute
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return -1, "", err
+		observeHttpRequest(0, err)
+		return response, err
 	}
+	observeHttpRequest(resp.StatusCode, nil)
 
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 
-	return resp.StatusCode, string(body), err
+	response.statusCode = resp.StatusCode
+	response.headers = resp.Header
+	response.body = string(body)
+	response.latency = time.Since(start)
+	return response, err
+}
+
+//
+// Parses directives such as "# @timeout 5m" from the comment lines of a script
+// If a directive is specified multiple times the first one wins
+//
+func parseScriptDirectives(content string) map[string]string {
+	directives := map[string]string{}
+	for _, line := range strings.Split(content, "\n") {
+		matches := scriptDirectivePattern.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		name := strings.ToLower(matches[1])
+		if _, exists := directives[name]; !exists {
+			directives[name] = matches[2]
+		}
+	}
+	return directives
+}
+
+//
+// Returns the values of all occurrences of a directive, e.g: all "# @assert" lines of a script
+//
+func parseScriptDirectiveValues(content string, directive string) []string {
+	values := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		matches := scriptDirectivePattern.FindStringSubmatch(line)
+		if matches != nil && strings.ToLower(matches[1]) == directive {
+			values = append(values, matches[2])
+		}
+	}
+	return values
+}
+
+//
+// Returns the names of the secrets a script requests via # @secret, e.g: # @secret dynatrace,github
+//
+func getScriptSecretNames(scriptFileName string) ([]string, error) {
+	content, err := ioutil.ReadFile(scriptFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	secretNames := []string{}
+	for _, value := range parseScriptDirectiveValues(string(content), "secret") {
+		secretNames = append(secretNames, splitAndTrim(value, ",")...)
+	}
+	return secretNames, nil
+}
+
+//
+// Returns the timeout for a script: either the one specified via "# @timeout" in the script or the global ScriptTimeout
+//
+func getScriptTimeout(scriptFileName string) time.Duration {
+	content, err := ioutil.ReadFile(scriptFileName)
+	if err != nil {
+		return ScriptTimeout
+	}
+
+	timeoutDirective, ok := parseScriptDirectives(string(content))["timeout"]
+	if !ok {
+		return ScriptTimeout
+	}
+
+	timeout, err := time.ParseDuration(timeoutDirective)
+	if err != nil || timeout < 0 {
+		log.Printf("Invalid timeout '%s' in %s - using default of %s", timeoutDirective, scriptFileName, ScriptTimeout.String())
+		return ScriptTimeout
+	}
+	return timeout
 }
 
 //
 // Executes the commands by adding data from the incomingEvent as Env-Variables
+// Of the env-variables of the service only serviceEnvVariables are passed. extraEnvVars are passed in addition, e.g: the secrets requested by the script
 //
-func executeCommandWithKeptnContext(command string, args []string, incomingEvent cloudevents.Event, directory *string) (string, error) {
+func executeCommandWithKeptnContext(ctx context.Context, command string, args []string, incomingEvent cloudevents.Event, serviceEnvVariables []string, extraEnvVars []string, directory *string, timeout time.Duration, outputWatcher io.Writer) (commandResult, error) {
 	// lets first replace all Keptn related placeholders
-	_, envVars := manageKeptnPlaceholders("", incomingEvent)
+	_, envVars := manageKeptnPlaceholders("", incomingEvent, serviceEnvVariables)
 
-	return executeCommand(command, args, envVars, directory)
+	return executeCommand(ctx, command, args, append(envVars, extraEnvVars...), directory, timeout, outputWatcher)
 }
 
 //
 // Executes a command, e.g: ls -l; ./yourscript.sh
 // Also sets the enviornment variables passed
+// If timeout > 0 the command and all processes it spawned get killed once the timeout is reached - the same happens when ctx is cancelled
+// stdout and stderr are logged while the command runs and kept up to ScriptOutputLimit bytes each
+// outputWatcher gets stdout while the command runs, e.g: to look for status updates. Can be nil
 //
-func executeCommand(command string, args []string, envs []string, directory *string) (string, error) {
+func executeCommand(ctx context.Context, command string, args []string, envs []string, directory *string, timeout time.Duration, outputWatcher io.Writer) (commandResult, error) {
+	if ctx.Err() != nil {
+		return commandResult{ExitCode: -1}, fmt.Errorf("%s was not executed: %s", command, ctx.Err().Error())
+	}
+
 	cmd := exec.Command(command, args...)
 	if directory != nil {
 		cmd.Dir = *directory
 	}
 
+	// run the command in its own process group so that a timeout also kills any child processes
+	setProcessGroup(cmd)
+
 	if VerboseLogging {
 		log.Printf("About to execute: %s with %s", command, args)
 
 		for _, envVariable := range envs {
-			log.Printf(envVariable)
+			log.Print(envVariable)
 		}
 	}
 
 	// pass environment variables
 	cmd.Env = envs
 
-	// Execute Command
-	out, err := cmd.CombinedOutput()
+	// Execute Command - stdout and stderr are kept separately and logged line by line
+	label := commandLabel(command, args)
+	stdout, stdoutLogger := newCappedBuffer(ScriptOutputLimit), newOutputLogger(label, "stdout")
+	stderr, stderrLogger := newCappedBuffer(ScriptOutputLimit), newOutputLogger(label, "stderr")
+	defer stdoutLogger.flush()
+	defer stderrLogger.flush()
+	stdoutWriters := []io.Writer{stdout, stdoutLogger}
+	if outputWatcher != nil {
+		stdoutWriters = append(stdoutWriters, outputWatcher)
+	}
+	cmd.Stdout = io.MultiWriter(stdoutWriters...)
+	cmd.Stderr = io.MultiWriter(stderr, stderrLogger)
+
+	start := time.Now()
+	result := func(exitCode int) commandResult {
+		return commandResult{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: exitCode, Duration: formatCommandDuration(time.Since(start))}
+	}
+
+	if err := cmd.Start(); err != nil {
+		return commandResult{ExitCode: -1}, fmt.Errorf("Error executing command %s %s: %s", command, strings.Join(args, " "), err.Error())
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timeoutChannel <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChannel = timer.C
+	}
+
+	var err error
+	select {
+	case err = <-done:
+	case <-timeoutChannel:
+		killCommand(cmd, done)
+		timeoutErr := &scriptTimeoutError{command: strings.TrimSpace(command + " " + strings.Join(args, " ")), timeout: timeout}
+		log.Printf("Error executing command: %s", timeoutErr.Error())
+		return result(-1), timeoutErr
+	case <-ctx.Done():
+		killCommand(cmd, done)
+		cancelErr := fmt.Errorf("%s was cancelled: %s", strings.TrimSpace(command+" "+strings.Join(args, " ")), ctx.Err().Error())
+		log.Printf("Error executing command: %s", cancelErr.Error())
+		return result(-1), cancelErr
+	}
+
 	if err != nil {
-		errMessage := fmt.Sprintf("Error executing command %s %s: %s\n%s", command, strings.Join(args, " "), err.Error(), string(out))
-		log.Printf(errMessage)
-		err = fmt.Errorf(errMessage)
+		exitCode := -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+		commandResult := result(exitCode)
 
-		return "", err
-	} else {
-		if VerboseLogging {
-			log.Printf("Script executed successful")
-			log.Printf("%s", string(out))
+		// the error tells what went wrong - usually that's on stderr
+		details := commandResult.Stderr
+		if details == "" {
+			details = commandResult.Stdout
 		}
+		errMessage := fmt.Sprintf("Error executing command %s %s: %s\n%s", command, strings.Join(args, " "), err.Error(), details)
+		log.Print(errMessage)
+
+		return commandResult, errors.New(errMessage)
 	}
 
-	return string(out), nil
+	if VerboseLogging {
+		log.Printf("Script executed successful")
+	}
+	return result(0), nil
+}
+
+//
+// Kills the process group of a running command and waits until it terminated or processKillGracePeriod passed
+//
+func killCommand(cmd *exec.Cmd, done <-chan error) {
+	if err := killProcessGroup(cmd); err != nil {
+		log.Printf("Failed to kill process group of %s: %s", cmd.Path, err.Error())
+	}
+
+	// give the killed processes a moment to release stdout/stderr - but don't wait forever in case a child escaped the process group
+	select {
+	case <-done:
+	case <-time.After(processKillGracePeriod):
+		log.Printf("%s did not terminate within %s after being killed", cmd.Path, processKillGracePeriod.String())
+	}
 }
@@ -1,6 +1,19 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+)
 
 func Test_replacePlaceHolderRecursively(t *testing.T) {
 	type args struct {
@@ -35,11 +48,451 @@ func Test_replacePlaceHolderRecursively(t *testing.T) {
 			},
 			want: "this should contain my-project and some-property and foo and bla",
 		},
+		{
+			name: "numbers and booleans",
+			args: args{
+				input:   "problem ${data.problem.id} at ${data.ratio} - canary=${data.canary} - ${data.ids[0]}",
+				keyPath: "",
+				values: map[string]interface{}{
+					"data": map[string]interface{}{
+						"problem": map[string]interface{}{"id": json.Number("6665700014152199021")},
+						"ratio":   0.25,
+						"canary":  false,
+						"ids":     []interface{}{float64(42)},
+					},
+				},
+			},
+			want: "problem 6665700014152199021 at 0.25 - canary=false - 42",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := replacePlaceHolderRecursively(tt.args.input, tt.args.keyPath, tt.args.values); got != tt.want {
-				t.Errorf("replacePlaceHolderRecursively() = %v, want %v", got, tt.want)
+			if got, _ := manageKeptnPlaceholdersRecursively(tt.args.input, []string{}, tt.args.keyPath, tt.args.values); got != tt.want {
+				t.Errorf("manageKeptnPlaceholdersRecursively() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseScriptDirectives(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]string
+	}{
+		{
+			name:    "bash script with directives",
+			content: "#!/bin/bash\n# @timeout 5m\n#@Timeout 10m\necho hello # @notadirective",
+			want:    map[string]string{"timeout": "5m"},
+		},
+		{
+			name:    "no directives",
+			content: "#!/bin/bash\n# just a comment\necho hello",
+			want:    map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseScriptDirectives(tt.content)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseScriptDirectives() = %v, want %v", got, tt.want)
+			}
+			for key, value := range tt.want {
+				if got[key] != value {
+					t.Errorf("parseScriptDirectives()[%s] = %v, want %v", key, got[key], value)
+				}
+			}
+		})
+	}
+}
+
+func Test_executeCommandTimeout(t *testing.T) {
+	start := time.Now()
+	// the background sleep would keep the output pipe open if only bash itself got killed
+	output, err := executeCommand(context.Background(), "bash", []string{"-c", "echo started; sleep 30 & sleep 30"}, []string{}, nil, 200*time.Millisecond, nil)
+
+	if _, ok := err.(*scriptTimeoutError); !ok {
+		t.Fatalf("executeCommand() error = %v, want scriptTimeoutError", err)
+	}
+	if output.Stdout != "started\n" || output.ExitCode != -1 {
+		t.Errorf("executeCommand() output = %q, exit code = %d, want %q, -1", output.Stdout, output.ExitCode, "started\n")
+	}
+	if elapsed := time.Since(start); elapsed >= processKillGracePeriod {
+		t.Errorf("executeCommand() took %s, process group was not killed", elapsed)
+	}
+}
+
+func Test_executeCommandCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	output, err := executeCommand(ctx, "bash", []string{"-c", "echo started; sleep 30 & sleep 30"}, []string{}, nil, 0, nil)
+
+	if err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("executeCommand() error = %v, want cancelled", err)
+	}
+	if output.Stdout != "started\n" || output.ExitCode != -1 {
+		t.Errorf("executeCommand() output = %q, exit code = %d, want %q, -1", output.Stdout, output.ExitCode, "started\n")
+	}
+	if elapsed := time.Since(start); elapsed >= processKillGracePeriod {
+		t.Errorf("executeCommand() took %s, process group was not killed", elapsed)
+	}
+}
+
+func Test_matchesStatusCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		patterns   []string
+		want       bool
+	}{
+		{name: "exact match", statusCode: 502, patterns: []string{"502", "503"}, want: true},
+		{name: "class match", statusCode: 504, patterns: []string{"5xx"}, want: true},
+		{name: "class match upper case", statusCode: 404, patterns: []string{"4XX"}, want: true},
+		{name: "no match", statusCode: 200, patterns: []string{"5xx", "404"}, want: false},
+		{name: "no patterns", statusCode: 500, patterns: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesStatusCode(tt.statusCode, tt.patterns); got != tt.want {
+				t.Errorf("matchesStatusCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_executeGenericHttpRequestRetries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	request := genericHttpRequest{
+		method: "GET",
+		uri:    server.URL,
+		options: httpRequestOptions{
+			timeout:      time.Second,
+			retries:      3,
+			retryOn:      []string{"502"},
+			retryBackoff: time.Millisecond,
+		},
+	}
+
+	response, err := executeGenericHttpRequest(context.Background(), request)
+	if err != nil {
+		t.Fatalf("executeGenericHttpRequest() error = %v", err)
+	}
+	if response.statusCode != 200 || response.body != "ok" {
+		t.Errorf("executeGenericHttpRequest() = %d %s, want 200 ok", response.statusCode, response.body)
+	}
+	if calls != 3 {
+		t.Errorf("executeGenericHttpRequest() sent %d requests, want 3", calls)
+	}
+}
+
+func newTestEvent(eventType string, data map[string]interface{}) cloudevents.Event {
+	event := cloudevents.NewEvent()
+	event.SetID("3a455fb7-7e48-4be0-9e20-468a007ec1b4")
+	event.SetSource("test")
+	event.SetType(eventType)
+	event.SetExtension("shkeptncontext", "e4158c2f-c0c3-41cf-b641-1c01b4cbbe9f")
+	event.SetData(cloudevents.ApplicationJSON, data)
+	return event
+}
+
+func Test_parseHttpRequestsFromString(t *testing.T) {
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "my-project"})
+
+	content := `# file level comment
+###
+# @name first
+GET https://example.com/${data.project}
+
+###
+# @on-failure continue
+POST https://example.com/second
+Content-Type: application/json
+
+{"project": "${data.project}"}
+###
+`
+	requests, err := parseHttpRequestsFromString(content, event, []string{})
+	if err != nil {
+		t.Fatalf("parseHttpRequestsFromString() error = %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("parseHttpRequestsFromString() returned %d requests, want 2", len(requests))
+	}
+	if requests[0].name != "first" || requests[0].method != "GET" || requests[0].uri != "https://example.com/my-project" || requests[0].options.continueOnFailure {
+		t.Errorf("unexpected first request: %+v", requests[0])
+	}
+	if requests[1].name != "request2" || requests[1].method != "POST" || requests[1].body != "{\"project\": \"my-project\"}\n" || !requests[1].options.continueOnFailure {
+		t.Errorf("unexpected second request: %+v", requests[1])
+	}
+}
+
+func Test_parseHttpRequestsHeaderDirectives(t *testing.T) {
+	content := `# @timeout 10s
+# @retries 3
+# @assert status 200
+# @name header
+###
+# @name first
+GET https://example.com/first
+
+###
+# @timeout 1m
+# @assert header Content-Type ^application/json
+POST https://example.com/second
+`
+	requests, err := parseHttpRequests(splitHttpRequestBlocks(content))
+	if err != nil {
+		t.Fatalf("parseHttpRequests() error = %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("parseHttpRequests() returned %d requests, want 2", len(requests))
+	}
+
+	// the header applies to both requests - unless they overwrite it
+	if requests[0].name != "first" || requests[0].options.timeout != 10*time.Second || requests[0].options.retries != 3 || len(requests[0].assertions) != 1 {
+		t.Errorf("unexpected first request: %+v", requests[0])
+	}
+	if requests[1].name != "request2" || requests[1].options.timeout != time.Minute || requests[1].options.retries != 3 || len(requests[1].assertions) != 2 {
+		t.Errorf("unexpected second request: %+v", requests[1])
+	}
+}
+
+func Test_parseHttpRequestFromString(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		wantMethod  string
+		wantURI     string
+		wantVersion string
+		wantHeaders http.Header
+		wantBody    string
+		wantErr     bool
+	}{
+		{
+			name:        "header values with colons",
+			content:     "POST https://example.com/hook\nAuthorization: Bearer a:b\nReferer: https://example.com:8443/path\n",
+			wantMethod:  "POST",
+			wantURI:     "https://example.com/hook",
+			wantHeaders: http.Header{"Authorization": {"Bearer a:b"}, "Referer": {"https://example.com:8443/path"}},
+		},
+		{
+			name:        "repeated headers",
+			content:     "GET https://example.com/\nAccept: text/html\naccept: application/json\nCookie: a=1\nCookie: b=2\n",
+			wantMethod:  "GET",
+			wantURI:     "https://example.com/",
+			wantHeaders: http.Header{"Accept": {"text/html", "application/json"}, "Cookie": {"a=1", "b=2"}},
+		},
+		{
+			name:        "multi-line header",
+			content:     "GET https://example.com/\nX-Tags: a,\n  b,\n\tc\n",
+			wantMethod:  "GET",
+			wantURI:     "https://example.com/",
+			wantHeaders: http.Header{"X-Tags": {"a, b, c"}},
+		},
+		{
+			name:        "HTTP version",
+			content:     "DELETE https://example.com/item HTTP/1.1\nHost: example.org\n",
+			wantMethod:  "DELETE",
+			wantURI:     "https://example.com/item",
+			wantVersion: "HTTP/1.1",
+			wantHeaders: http.Header{"Host": {"example.org"}},
+		},
+		{
+			name:        "URI with HTTP version",
+			content:     "https://example.com/ HTTP/2",
+			wantMethod:  "GET",
+			wantURI:     "https://example.com/",
+			wantVersion: "HTTP/2",
+			wantHeaders: http.Header{},
+		},
+		{
+			name:        "query string over multiple lines",
+			content:     "GET https://example.com/api\n  ?project=sockshop\n  &stage=staging\nAccept: application/json\n",
+			wantMethod:  "GET",
+			wantURI:     "https://example.com/api?project=sockshop&stage=staging",
+			wantHeaders: http.Header{"Accept": {"application/json"}},
+		},
+		{
+			name:        "comments and Windows line endings",
+			content:     "// a comment\r\n# @name first\r\nPOST https://example.com/\r\n# a comment between headers\r\nContent-Type: text/plain\r\n\r\nhello\r\n",
+			wantMethod:  "POST",
+			wantURI:     "https://example.com/",
+			wantHeaders: http.Header{"Content-Type": {"text/plain"}},
+			wantBody:    "hello\n",
+		},
+		{
+			name:        "body with empty lines",
+			content:     "POST https://example.com/\nContent-Type: text/plain\n\nfirst paragraph\n\nsecond paragraph\n# @assert status 200\n\n",
+			wantMethod:  "POST",
+			wantURI:     "https://example.com/",
+			wantHeaders: http.Header{"Content-Type": {"text/plain"}},
+			wantBody:    "first paragraph\n\nsecond paragraph\n",
+		},
+		{name: "header without colon", content: "GET https://example.com/\nAccept\n", wantErr: true},
+		{name: "header without name", content: "GET https://example.com/\n: value\n", wantErr: true},
+		{name: "continuation without header", content: "GET https://example.com/\n  value\n", wantErr: true},
+		{name: "invalid HTTP version", content: "GET https://example.com/ HTTP/x\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseHttpRequestFromString(tt.content)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHttpRequestFromString() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.method != tt.wantMethod || got.uri != tt.wantURI || got.version != tt.wantVersion {
+				t.Errorf("parseHttpRequestFromString() = %s %s %s, want %s %s %s", got.method, got.uri, got.version, tt.wantMethod, tt.wantURI, tt.wantVersion)
+			}
+			if !reflect.DeepEqual(got.headers, tt.wantHeaders) {
+				t.Errorf("parseHttpRequestFromString() headers = %v, want %v", got.headers, tt.wantHeaders)
+			}
+			if got.body != tt.wantBody {
+				t.Errorf("parseHttpRequestFromString() body = %q, want %q", got.body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func Test_parseHttpRequestsSampleFiles(t *testing.T) {
+	tests := []struct {
+		file        string
+		wantMethod  string
+		wantURI     string
+		wantHeaders http.Header
+		// the JSON bodies of the samples contain unquoted placeholders - so only check that the whole body is there
+		wantBody bool
+	}{
+		{
+			file:        "generic-executor/all.events.http",
+			wantMethod:  "POST",
+			wantURI:     "https://${secret.dynatrace.DT_TENANT}/api/v1/entity/infrastructure/custom/keptn",
+			wantHeaders: http.Header{"Content-Type": {"application/json"}, "Authorization": {"Api-Token ${secret.dynatrace.DT_API_TOKEN}"}},
+			wantBody:    true,
+		},
+		{
+			file:        "generic-executor/deployment.triggered.http",
+			wantMethod:  "POST",
+			wantURI:     "https://webhook.site/298d12c4-f283-4453-9dcb-8125a3172bdc",
+			wantHeaders: http.Header{"Accept": {"application/json"}, "Cache-Control": {"no-cache"}, "Content-Type": {"application/cloudevents+json"}},
+			wantBody:    true,
+		},
+		{
+			file:        "generic-executor/test.triggered.http",
+			wantMethod:  "GET",
+			wantURI:     "${data.deployment.deploymentURIsPublic[0]}",
+			wantHeaders: http.Header{"Accept": {"text/html"}},
+		},
+		{
+			file:        "script-repository/send.dynatrace.metric.http",
+			wantMethod:  "POST",
+			wantURI:     "https://$ENV_DT_TENANT/api/v1/entity/infrastructure/custom/keptn",
+			wantHeaders: http.Header{"Content-Type": {"application/json"}, "Authorization": {"Api-Token $ENV_DT_API_TOKEN"}},
+			wantBody:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			content, err := ioutil.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the files are parsed as they are - placeholders are covered by the tests of resolveRequest
+			requests, err := parseHttpRequests(splitHttpRequestBlocks(string(content)))
+			if err != nil {
+				t.Fatalf("parseHttpRequests() error = %v", err)
+			}
+			if len(requests) != 1 {
+				t.Fatalf("parseHttpRequests() returned %d requests, want 1", len(requests))
+			}
+			got := requests[0]
+			if got.method != tt.wantMethod || got.uri != tt.wantURI {
+				t.Errorf("parseHttpRequests() = %s %s, want %s %s", got.method, got.uri, tt.wantMethod, tt.wantURI)
+			}
+			if !reflect.DeepEqual(got.headers, tt.wantHeaders) {
+				t.Errorf("parseHttpRequests() headers = %v, want %v", got.headers, tt.wantHeaders)
+			}
+			if gotBody := strings.HasPrefix(got.body, "{\n") && strings.HasSuffix(got.body, "\n}\n"); gotBody != tt.wantBody {
+				t.Errorf("parseHttpRequests() body = %q, want the whole JSON body %v", got.body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func Test_sendGenericHttpRequestHeaders(t *testing.T) {
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+	defer server.Close()
+
+	request, err := parseHttpRequestFromString("GET " + server.URL + " HTTP/1.1\nHost: example.com\nAccept: text/html\nAccept: application/json\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sendGenericHttpRequest(context.Background(), http.Client{Timeout: time.Second}, request); err != nil {
+		t.Fatalf("sendGenericHttpRequest() error = %v", err)
+	}
+	if received.Host != "example.com" || !reflect.DeepEqual(received.Header["Accept"], []string{"text/html", "application/json"}) {
+		t.Errorf("sendGenericHttpRequest() sent Host %s and Accept %v", received.Host, received.Header["Accept"])
+	}
+}
+
+func Test_executeGenericHttpRequestsStopsOnFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	newRequest := func(name string, path string, continueOnFailure bool) genericHttpRequest {
+		return genericHttpRequest{name: name, method: "GET", uri: server.URL + path, options: httpRequestOptions{continueOnFailure: continueOnFailure}}
+	}
+
+	tests := []struct {
+		name     string
+		requests []genericHttpRequest
+		want     []string
+	}{
+		{
+			name:     "stops after failure",
+			requests: []genericHttpRequest{newRequest("a", "/ok", false), newRequest("b", "/fail", false), newRequest("c", "/ok", false)},
+			want:     []string{"pass", "fail", "skipped"},
+		},
+		{
+			name:     "continues after failure",
+			requests: []genericHttpRequest{newRequest("a", "/fail", true), newRequest("b", "/ok", false)},
+			want:     []string{"fail", "pass"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := executeGenericHttpRequests(context.Background(), tt.requests)
+			got := []string{}
+			for _, result := range results {
+				if result.Skipped {
+					got = append(got, "skipped")
+				} else {
+					got = append(got, string(result.Result))
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("executeGenericHttpRequests() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// httpAssertion is a check on the response of a .http request, e.g: # @assert status 200,201
+// If the check fails, the request result is set to severity (fail for @assert, warning for @assert-warning)
+type httpAssertion struct {
+	expression string
+	kind       string
+	target     string
+	operator   string
+	expected   string
+	pattern    *regexp.Regexp
+	severity   keptnv2.ResultType
+}
+
+// httpAssertionResult is the outcome of an httpAssertion as it is reported in the finished event
+type httpAssertionResult struct {
+	Assertion string             `json:"assertion"`
+	Result    keptnv2.ResultType `json:"result"`
+	Message   string             `json:"message,omitempty"`
+}
+
+// defaultStatusAssertion is used for requests that don't specify their own status assertion
+var defaultStatusAssertion = httpAssertion{expression: "status 2xx", kind: "status", expected: "2xx", severity: keptnv2.ResultFailed}
+
+//
+// Parses all # @assert and # @assert-warning directives of a .http request. Supported assertions are
+// status 200,201,2xx               -> the status code must match one of the list
+// header Content-Type json$        -> the header must match the regular expression
+// jsonpath $.status == "ok"        -> the value in the JSON body must fulfill the condition. Operators: ==, !=, <, <=, >, >=, =~ (regex), exists
+// latency 500ms                    -> the request must not take longer than that
+//
+func parseHttpAssertions(content string) ([]httpAssertion, error) {
+	assertions := []httpAssertion{}
+	severities := []keptnv2.ResultType{keptnv2.ResultFailed, keptnv2.ResultWarning}
+	for ix, directive := range []string{"assert", "assert-warning"} {
+		for _, expression := range parseScriptDirectiveValues(content, directive) {
+			assertion, err := parseHttpAssertion(expression, severities[ix])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid @%s %s: %s", directive, expression, err.Error())
+			}
+			assertions = append(assertions, assertion)
+		}
+	}
+	return assertions, nil
+}
+
+func parseHttpAssertion(expression string, severity keptnv2.ResultType) (httpAssertion, error) {
+	assertion := httpAssertion{expression: expression, severity: severity}
+
+	fields := strings.Fields(expression)
+	if len(fields) < 2 {
+		return assertion, fmt.Errorf("expected <kind> <condition>")
+	}
+	assertion.kind = strings.ToLower(fields[0])
+
+	switch assertion.kind {
+	case "status":
+		assertion.expected = strings.Join(fields[1:], "")
+	case "latency":
+		if _, err := time.ParseDuration(fields[1]); err != nil {
+			return assertion, err
+		}
+		assertion.expected = fields[1]
+	case "header":
+		if len(fields) < 3 {
+			return assertion, fmt.Errorf("expected header <name> <regex>")
+		}
+		assertion.target = fields[1]
+		assertion.expected = strings.Join(fields[2:], " ")
+		pattern, err := regexp.Compile(assertion.expected)
+		if err != nil {
+			return assertion, err
+		}
+		assertion.pattern = pattern
+	case "jsonpath":
+		if len(fields) < 3 {
+			return assertion, fmt.Errorf("expected jsonpath <path> <operator> [value]")
+		}
+		assertion.target = fields[1]
+		assertion.operator = fields[2]
+		assertion.expected = strings.Join(fields[3:], " ")
+		switch assertion.operator {
+		case "exists":
+		case "==", "!=", "<", "<=", ">", ">=":
+			if assertion.expected == "" {
+				return assertion, fmt.Errorf("missing value for operator %s", assertion.operator)
+			}
+		case "=~":
+			pattern, err := regexp.Compile(assertion.expected)
+			if err != nil {
+				return assertion, err
+			}
+			assertion.pattern = pattern
+		default:
+			return assertion, fmt.Errorf("unsupported operator %s", assertion.operator)
+		}
+	default:
+		return assertion, fmt.Errorf("unsupported assertion %s - must be status, header, jsonpath or latency", assertion.kind)
+	}
+
+	return assertion, nil
+}
+
+//
+// Evaluates all assertions on a response and returns the overall result: fail if an @assert failed, warning if an @assert-warning failed and pass otherwise
+//
+func evaluateHttpAssertions(assertions []httpAssertion, response genericHttpResponse) (keptnv2.ResultType, []httpAssertionResult) {
+	hasStatusAssertion := false
+	for _, assertion := range assertions {
+		if assertion.kind == "status" {
+			hasStatusAssertion = true
+		}
+	}
+	if !hasStatusAssertion {
+		assertions = append([]httpAssertion{defaultStatusAssertion}, assertions...)
+	}
+
+	// the body is only parsed once for all jsonpath assertions
+	var document interface{}
+	documentErr := json.Unmarshal([]byte(response.body), &document)
+
+	result := keptnv2.ResultPass
+	assertionResults := []httpAssertionResult{}
+	for _, assertion := range assertions {
+		assertionResult := httpAssertionResult{Assertion: assertion.expression, Result: keptnv2.ResultPass}
+
+		var err error
+		if assertion.kind == "jsonpath" && documentErr != nil {
+			err = fmt.Errorf("body is not valid JSON: %s", documentErr.Error())
+		} else {
+			err = assertion.evaluate(response, document)
+		}
+
+		if err != nil {
+			assertionResult.Result = assertion.severity
+			assertionResult.Message = err.Error()
+			result = worseResult(result, assertion.severity)
+		}
+		assertionResults = append(assertionResults, assertionResult)
+	}
+
+	return result, assertionResults
+}
+
+//
+// Returns nil if the response fulfills the assertion - otherwise an error that explains why not
+//
+func (assertion httpAssertion) evaluate(response genericHttpResponse, document interface{}) error {
+	switch assertion.kind {
+	case "status":
+		if !matchesStatusCode(response.statusCode, strings.Split(assertion.expected, ",")) {
+			return fmt.Errorf("status code %d is not %s", response.statusCode, assertion.expected)
+		}
+	case "latency":
+		maxLatency, _ := time.ParseDuration(assertion.expected)
+		if response.latency > maxLatency {
+			return fmt.Errorf("latency %s exceeds %s", response.latency.String(), maxLatency.String())
+		}
+	case "header":
+		values, exists := response.headers[http.CanonicalHeaderKey(assertion.target)]
+		if !exists {
+			return fmt.Errorf("header %s is missing", assertion.target)
+		}
+		for _, value := range values {
+			if assertion.pattern.MatchString(value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("header %s: %s doesn't match %s", assertion.target, strings.Join(values, ", "), assertion.expected)
+	case "jsonpath":
+		value, exists, err := evaluateJSONPath(document, assertion.target)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%s doesn't exist", assertion.target)
+		}
+		return compareJSONValue(assertion.target, value, assertion.operator, assertion.expected, assertion.pattern)
+	}
+	return nil
+}
+
+//
+// Compares a value from a JSON document with the expected value of an assertion. The expected value is parsed as JSON if possible, e.g: "ok", 5 or true
+//
+func compareJSONValue(path string, actual interface{}, operator string, expectedString string, pattern *regexp.Regexp) error {
+	actualJSON, _ := json.Marshal(actual)
+
+	switch operator {
+	case "exists":
+		return nil
+	case "=~":
+		actualString, isString := actual.(string)
+		if !isString {
+			actualString = string(actualJSON)
+		}
+		if !pattern.MatchString(actualString) {
+			return fmt.Errorf("%s: %s doesn't match %s", path, actualString, expectedString)
+		}
+		return nil
+	}
+
+	var expected interface{}
+	if err := json.Unmarshal([]byte(expectedString), &expected); err != nil {
+		// not valid JSON - so we treat it as a plain string
+		expected = expectedString
+	}
+	expectedJSON, _ := json.Marshal(expected)
+
+	switch operator {
+	case "==":
+		if string(actualJSON) != string(expectedJSON) {
+			return fmt.Errorf("%s: %s is not %s", path, actualJSON, expectedJSON)
+		}
+	case "!=":
+		if string(actualJSON) == string(expectedJSON) {
+			return fmt.Errorf("%s: %s is %s", path, actualJSON, expectedJSON)
+		}
+	default:
+		actualNumber, actualIsNumber := actual.(float64)
+		expectedNumber, expectedIsNumber := expected.(float64)
+		if !actualIsNumber || !expectedIsNumber {
+			return fmt.Errorf("%s: %s and %s must be numbers for operator %s", path, actualJSON, expectedJSON, operator)
+		}
+		fulfilled := map[string]bool{
+			"<":  actualNumber < expectedNumber,
+			"<=": actualNumber <= expectedNumber,
+			">":  actualNumber > expectedNumber,
+			">=": actualNumber >= expectedNumber,
+		}[operator]
+		if !fulfilled {
+			return fmt.Errorf("%s: %s is not %s %s", path, actualJSON, operator, expectedJSON)
+		}
+	}
+	return nil
+}
+
+//
+// Returns the worse of two results: fail > warning > pass
+//
+func worseResult(a keptnv2.ResultType, b keptnv2.ResultType) keptnv2.ResultType {
+	rank := map[keptnv2.ResultType]int{keptnv2.ResultPass: 0, keptnv2.ResultWarning: 1, keptnv2.ResultFailed: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func Test_evaluateJSONPath(t *testing.T) {
+	document := map[string]interface{}{
+		"status": "ok",
+		"items": []interface{}{
+			map[string]interface{}{"name": "first"},
+		},
+		"with.dot": true,
+	}
+	tests := []struct {
+		name       string
+		path       string
+		want       interface{}
+		wantExists bool
+		wantErr    bool
+	}{
+		{name: "root child", path: "$.status", want: "ok", wantExists: true},
+		{name: "array index", path: "$.items[0].name", want: "first", wantExists: true},
+		{name: "bracket notation", path: "$['with.dot']", want: true, wantExists: true},
+		{name: "missing key", path: "$.nothing", wantExists: false},
+		{name: "index out of range", path: "$.items[1]", wantExists: false},
+		{name: "missing $", path: "status", wantErr: true},
+		{name: "wildcard", path: "$.items[*]", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, exists, err := evaluateJSONPath(document, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evaluateJSONPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if exists != tt.wantExists || (exists && got != tt.want) {
+				t.Errorf("evaluateJSONPath() = %v, %v, want %v, %v", got, exists, tt.want, tt.wantExists)
+			}
+		})
+	}
+}
+
+func Test_evaluateHttpAssertions(t *testing.T) {
+	response := genericHttpResponse{
+		statusCode: 200,
+		headers:    http.Header{"Content-Type": []string{"application/json; charset=utf-8"}},
+		body:       `{"status": "ok", "count": 5}`,
+		latency:    100 * time.Millisecond,
+	}
+	tests := []struct {
+		name     string
+		content  string
+		response genericHttpResponse
+		want     keptnv2.ResultType
+	}{
+		{name: "no assertions and 2xx", content: "GET http://localhost", response: response, want: keptnv2.ResultPass},
+		{name: "no assertions and 404", content: "GET http://localhost", response: genericHttpResponse{statusCode: 404}, want: keptnv2.ResultFailed},
+		{name: "status assertion replaces the default", content: "# @assert status 404\nGET http://localhost", response: genericHttpResponse{statusCode: 404}, want: keptnv2.ResultPass},
+		{name: "all assertions pass", content: "# @assert header content-type ^application/json\n# @assert jsonpath $.status == \"ok\"\n# @assert jsonpath $.count >= 5\n# @assert latency 1s", response: response, want: keptnv2.ResultPass},
+		{name: "failing warning", content: "# @assert-warning latency 50ms\n# @assert jsonpath $.status =~ ^o", response: response, want: keptnv2.ResultWarning},
+		{name: "failing assertion wins over warning", content: "# @assert-warning latency 50ms\n# @assert jsonpath $.status != ok", response: response, want: keptnv2.ResultFailed},
+		{name: "missing header", content: "# @assert header X-Trace .*", response: response, want: keptnv2.ResultFailed},
+		{name: "body is not json", content: "# @assert jsonpath $.status exists", response: genericHttpResponse{statusCode: 200, body: "ok"}, want: keptnv2.ResultFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertions, err := parseHttpAssertions(tt.content)
+			if err != nil {
+				t.Fatalf("parseHttpAssertions() error = %v", err)
+			}
+			if got, details := evaluateHttpAssertions(assertions, tt.response); got != tt.want {
+				t.Errorf("evaluateHttpAssertions() = %v, want %v: %+v", got, tt.want, details)
+			}
+		})
+	}
+}
+
+func Test_parseHttpAssertionsInvalid(t *testing.T) {
+	for _, content := range []string{"# @assert jsonpath $.a ~ b", "# @assert latency fast", "# @assert body contains", "# @assert header X-Trace ("} {
+		if _, err := parseHttpAssertions(content); err == nil {
+			t.Errorf("parseHttpAssertions(%q) expected an error", content)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// httpCapture extracts a value from the response of a .http request, e.g: # @capture start $.startTime
+// Captured values end up as properties of the task in the finished event, e.g: data.test.start
+type httpCapture struct {
+	name   string
+	source string
+	target string
+}
+
+//
+// Parses all # @capture directives of a .http request. Supported sources are
+// $.json.path          -> value in the JSON body
+// header X-Trace-Id    -> value of a response header
+// status               -> the status code
+// body                 -> the raw body
+//
+func parseHttpCaptures(content string) ([]httpCapture, error) {
+	captures := []httpCapture{}
+	for _, expression := range parseScriptDirectiveValues(content, "capture") {
+		fields := strings.Fields(expression)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("Invalid @capture %s: expected <name> <source>", expression)
+		}
+
+		capture := httpCapture{name: fields[0]}
+		switch {
+		case strings.HasPrefix(fields[1], "$"):
+			capture.source = "jsonpath"
+			capture.target = fields[1]
+			if _, _, err := evaluateJSONPath(nil, capture.target); err != nil {
+				return nil, fmt.Errorf("Invalid @capture %s: %s", expression, err.Error())
+			}
+		case fields[1] == "header" && len(fields) == 3:
+			capture.source = "header"
+			capture.target = fields[2]
+		case fields[1] == "status" || fields[1] == "body":
+			capture.source = fields[1]
+		default:
+			return nil, fmt.Errorf("Invalid @capture %s: source must be a JSONPath, header <name>, status or body", expression)
+		}
+		captures = append(captures, capture)
+	}
+	return captures, nil
+}
+
+//
+// Returns the values of all captures that could be found in the response
+//
+func evaluateHttpCaptures(captures []httpCapture, response genericHttpResponse) map[string]interface{} {
+	values := map[string]interface{}{}
+	var document interface{}
+	documentErr := json.Unmarshal([]byte(response.body), &document)
+
+	for _, capture := range captures {
+		switch capture.source {
+		case "jsonpath":
+			if documentErr != nil {
+				log.Printf("Can't capture %s as the body is not valid JSON: %s", capture.name, documentErr.Error())
+				continue
+			}
+			value, exists, err := evaluateJSONPath(document, capture.target)
+			if err != nil || !exists {
+				log.Printf("Can't capture %s as %s doesn't exist in the body", capture.name, capture.target)
+				continue
+			}
+			values[capture.name] = value
+		case "header":
+			value := response.headers.Get(http.CanonicalHeaderKey(capture.target))
+			if value == "" {
+				log.Printf("Can't capture %s as header %s is missing", capture.name, capture.target)
+				continue
+			}
+			values[capture.name] = value
+		case "status":
+			values[capture.name] = response.statusCode
+		case "body":
+			values[capture.name] = response.body
+		}
+	}
+	return values
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func Test_evaluateHttpCaptures(t *testing.T) {
+	response := genericHttpResponse{
+		statusCode: 201,
+		headers:    http.Header{"X-Trace-Id": []string{"abc"}},
+		body:       `{"test": {"start": "2021-04-06T10:35:19Z", "runs": [1, 2]}}`,
+	}
+	captures, err := parseHttpCaptures("# @capture start $.test.start\n# @capture runs $.test.runs\n# @capture trace header x-trace-id\n# @capture code status\n# @capture missing $.test.end")
+	if err != nil {
+		t.Fatalf("parseHttpCaptures() error = %v", err)
+	}
+
+	got := evaluateHttpCaptures(captures, response)
+	want := map[string]interface{}{"start": "2021-04-06T10:35:19Z", "trace": "abc", "code": 201}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("evaluateHttpCaptures()[%s] = %v, want %v", name, got[name], value)
+		}
+	}
+	if runs, ok := got["runs"].([]interface{}); !ok || len(runs) != 2 {
+		t.Errorf("evaluateHttpCaptures()[runs] = %v, want [1 2]", got["runs"])
+	}
+	if _, exists := got["missing"]; exists {
+		t.Errorf("evaluateHttpCaptures() captured a value for a path that doesn't exist")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Interpreters maps the extension of a script to the command that executes it, e.g: .js -> node. More can be added via INTERPRETERS
+var Interpreters = map[string]string{
+	".sh": "bash",
+	".py": "python3",
+}
+
+//
+// Adds interpreters to the registry, e.g: from INTERPRETERS=.js:node,.ps1:pwsh -File. Extensions without leading dot get one
+//
+func registerInterpreters(interpreters map[string]string) error {
+	for extension, command := range normalizeInterpreters(interpreters) {
+		if extension == ".http" {
+			return fmt.Errorf("Invalid interpreter for %s: .http files are sent as HTTP requests", extension)
+		}
+		if strings.TrimSpace(command) == "" {
+			return fmt.Errorf("Invalid interpreter for %s: command is empty", extension)
+		}
+		Interpreters[extension] = command
+	}
+	return nil
+}
+
+//
+// Returns the interpreters with lower case extensions that start with a dot
+//
+func normalizeInterpreters(interpreters map[string]string) map[string]string {
+	normalized := map[string]string{}
+	for extension, command := range interpreters {
+		extension = strings.ToLower(strings.TrimSpace(extension))
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		normalized[extension] = command
+	}
+	return normalized
+}
+
+//
+// Returns the extensions we look for scripts with: .sh, .py, .http and .http.tmpl first, then all other registered ones in alphabetical order
+// The last one is no extension at all, e.g: test.triggered - such scripts are executed with the interpreter of their shebang line
+// projectInterpreters are the interpreters a project registered in generic-executor.yaml
+//
+func getScriptExtensions(projectInterpreters map[string]string) []string {
+	extensions := []string{".sh", ".py", ".http", httpTemplateExtension}
+	known := map[string]bool{".sh": true, ".py": true, ".http": true, httpTemplateExtension: true}
+
+	others := []string{}
+	for _, interpreters := range []map[string]string{Interpreters, normalizeInterpreters(projectInterpreters)} {
+		for extension := range interpreters {
+			if !known[extension] {
+				known[extension] = true
+				others = append(others, extension)
+			}
+		}
+	}
+	sort.Strings(others)
+
+	return append(append(extensions, others...), "")
+}
+
+//
+// Returns the interpreter command and its arguments for a script
+// The extension is looked up in projectInterpreters first, then in Interpreters. Scripts with an unknown extension are executed with the interpreter of their shebang line, e.g: #!/usr/bin/env node
+//
+func getInterpreter(scriptFileName string, projectInterpreters map[string]string) ([]string, error) {
+	extension := strings.ToLower(filepath.Ext(scriptFileName))
+	if command, ok := normalizeInterpreters(projectInterpreters)[extension]; ok && extension != "" {
+		return strings.Fields(command), nil
+	}
+	if command, ok := Interpreters[extension]; ok {
+		return strings.Fields(command), nil
+	}
+
+	interpreter, err := readShebang(scriptFileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(interpreter) == 0 {
+		return nil, fmt.Errorf("Unhandled extension for file %s: register an interpreter for %s or add a shebang line", scriptFileName, extension)
+	}
+	return interpreter, nil
+}
+
+//
+// Returns the interpreter and its arguments from the first line of a script, e.g: #!/usr/bin/env python3 -> [/usr/bin/env python3]
+// Returns an empty list if the script doesn't start with #!
+//
+func readShebang(scriptFileName string) ([]string, error) {
+	file, err := os.Open(scriptFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	firstLine, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && firstLine == "" {
+		// empty file
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(firstLine, "#!") {
+		return []string{}, nil
+	}
+	return strings.Fields(strings.TrimPrefix(firstLine, "#!")), nil
+}
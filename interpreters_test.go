@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func Test_getInterpreter(t *testing.T) {
+	directory, err := ioutil.TempDir("", "interpreters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	files := map[string]string{
+		"test.sh":      "echo test\n",
+		"test.JS":      "console.log('test')\n",
+		"test.rb":      "#!/usr/bin/env ruby -w\nputs 'test'\n",
+		"test":         "#!/bin/sh",
+		"test.unknown": "echo test\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(directory, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := registerInterpreters(map[string]string{"js": "node"}); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(Interpreters, ".js")
+
+	tests := []struct {
+		name                string
+		file                string
+		projectInterpreters map[string]string
+		want                []string
+		wantErr             bool
+	}{
+		{name: "default interpreter", file: "test.sh", want: []string{"bash"}},
+		{name: "registered interpreter", file: "test.JS", want: []string{"node"}},
+		{name: "project interpreter wins", file: "test.sh", projectInterpreters: map[string]string{".sh": "zsh -e"}, want: []string{"zsh", "-e"}},
+		{name: "shebang", file: "test.rb", want: []string{"/usr/bin/env", "ruby", "-w"}},
+		{name: "shebang without new line", file: "test", want: []string{"/bin/sh"}},
+		{name: "unknown extension", file: "test.unknown", wantErr: true},
+		{name: "missing file", file: "missing.unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getInterpreter(filepath.Join(directory, tt.file), tt.projectInterpreters)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getInterpreter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getInterpreter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_registerInterpreters(t *testing.T) {
+	if err := registerInterpreters(map[string]string{".http": "curl"}); err == nil {
+		t.Errorf("registerInterpreters() accepted an interpreter for .http")
+	}
+	if err := registerInterpreters(map[string]string{".js": " "}); err == nil {
+		t.Errorf("registerInterpreters() accepted an empty command")
+	}
+
+	if err := registerInterpreters(map[string]string{".ps1": "pwsh -File"}); err != nil {
+		t.Fatal(err)
+	}
+	defer delete(Interpreters, ".ps1")
+
+	got := getScriptExtensions(map[string]string{"JS": "node", ".py": "python3 -u"})
+	want := []string{".sh", ".py", ".http", ".http.tmpl", ".js", ".ps1", ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getScriptExtensions() = %v, want %v", got, want)
+	}
+}
+
+func Test_findScriptWithoutExtension(t *testing.T) {
+	directory, err := ioutil.TempDir("", "interpreters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	// the local file system looks for generic-executor/ in the working directory
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workingDirectory)
+	if err := os.Chdir(directory); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("generic-executor", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("generic-executor/action.triggered.cleanup", []byte("#!/bin/sh\necho cleaned up $DATA_PROJECT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	event := newTestEvent("sh.keptn.event.action.triggered", map[string]interface{}{"project": "sockshop", "stage": "dev", "service": "carts"})
+	myKeptn, err := keptnv2.NewKeptn(&event, keptn.KeptnOpts{UseLocalFileSystem: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions, _, err := findScriptActions(myKeptn, []string{"action.triggered.cleanup"}, event, []string{}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || actions[0].name != "generic-executor/action.triggered.cleanup" {
+		t.Fatalf("findScriptActions() = %v, want generic-executor/action.triggered.cleanup", actions)
+	}
+
+	outcome, err := executeScriptOrHTTP(context.Background(), actions[0], event, []string{"PATH=" + os.Getenv("PATH")})
+	if err != nil {
+		t.Fatalf("executeScriptOrHTTP() error = %v", err)
+	}
+	if strings.TrimSpace(outcome.output) != "cleaned up sockshop" {
+		t.Errorf("executeScriptOrHTTP() output = %q, want %q", outcome.output, "cleaned up sockshop")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//
+// Returns the value at a JSONPath such as $.data.items[0].name or $['data']['name'] within a decoded JSON document
+// Only child and array index selectors are supported - no wildcards, filters or recursive descent
+// The second return value is false if the path doesn't exist in the document
+//
+func evaluateJSONPath(document interface{}, path string) (interface{}, bool, error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, false, fmt.Errorf("Invalid JSONPath %s: must start with $", path)
+	}
+
+	current := document
+	remaining := path[1:]
+	for remaining != "" {
+		var key string
+		index := -1
+
+		switch {
+		case strings.HasPrefix(remaining, "."):
+			remaining = remaining[1:]
+			end := strings.IndexAny(remaining, ".[")
+			if end < 0 {
+				end = len(remaining)
+			}
+			key = remaining[:end]
+			remaining = remaining[end:]
+			if key == "" || key == "*" {
+				return nil, false, fmt.Errorf("Invalid JSONPath %s: unsupported or empty key", path)
+			}
+		case strings.HasPrefix(remaining, "['") || strings.HasPrefix(remaining, "[\""):
+			quote := remaining[1:2]
+			end := strings.Index(remaining[2:], quote+"]")
+			if end < 0 {
+				return nil, false, fmt.Errorf("Invalid JSONPath %s: missing %s]", path, quote)
+			}
+			key = remaining[2 : 2+end]
+			remaining = remaining[2+end+2:]
+		case strings.HasPrefix(remaining, "["):
+			end := strings.Index(remaining, "]")
+			if end < 0 {
+				return nil, false, fmt.Errorf("Invalid JSONPath %s: missing ]", path)
+			}
+			parsedIndex, err := strconv.Atoi(remaining[1:end])
+			if err != nil || parsedIndex < 0 {
+				return nil, false, fmt.Errorf("Invalid JSONPath %s: unsupported index %s", path, remaining[1:end])
+			}
+			index = parsedIndex
+			remaining = remaining[end+1:]
+		default:
+			return nil, false, fmt.Errorf("Invalid JSONPath %s: unexpected %s", path, remaining)
+		}
+
+		if index >= 0 {
+			array, ok := current.([]interface{})
+			if !ok || index >= len(array) {
+				return nil, false, nil
+			}
+			current = array[index]
+		} else {
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false, nil
+			}
+			value, exists := object[key]
+			if !exists {
+				return nil, false, nil
+			}
+			current = value
+		}
+	}
+
+	return current, true, nil
+}
@@ -3,8 +3,13 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
 	"github.com/kelseyhightower/envconfig"
@@ -25,6 +30,55 @@ type envConfig struct {
 	VerboseLogging bool `envconfig:"VERBOSE_LOGGING" default:"false"`
 	// URL of the Keptn configuration service (this is where we can fetch files from the config repo)
 	ConfigurationServiceUrl string `envconfig:"CONFIGURATION_SERVICE" default:""`
+	// Whether only the first script found for an event is executed or all scripts on service, stage and project level: first or all. Can be overwritten per project in generic-executor.yaml
+	ExecutionMode string `envconfig:"EXECUTION_MODE" default:"first"`
+	// Additional interpreters by extension, e.g: .js:node,.ps1:pwsh -File. .sh (bash) and .py (python3) are always registered but can be overwritten
+	Interpreters map[string]string `envconfig:"INTERPRETERS" default:""`
+	// How long resources and negative lookups of the configuration service are cached (0 = no cache). A configuration change of a project drops its cached resources
+	ResourceCacheTTL time.Duration `envconfig:"RESOURCE_CACHE_TTL" default:"1m"`
+	// Directory in which every event gets its own workspace. Defaults to the directory for temporary files, e.g: /tmp
+	WorkspaceDirectory string `envconfig:"WORKSPACE_DIR" default:""`
+	// Whether the workspace of an event is kept if a script or request failed - e.g: to inspect what the scripts wrote
+	KeepWorkspaceOnFailure bool `envconfig:"KEEP_WORKSPACE_ON_FAILURE" default:"false"`
+	// Default time a script may run before it gets killed (0 = no timeout). Can be overwritten per script with # @timeout
+	ScriptTimeout time.Duration `envconfig:"SCRIPT_TIMEOUT" default:"30m"`
+	// What happens with placeholders of .http files the event has no value for: error, warn or empty. Can be overwritten per file with # @unresolved
+	UnresolvedPlaceholders string `envconfig:"UNRESOLVED_PLACEHOLDERS" default:"warn"`
+	// What exit codes of scripts mean, e.g: 0=pass,2=warning,3=fail/errored,*=fail. Can be extended per script with # @exit-codes
+	ExitCodeMapping string `envconfig:"EXIT_CODE_MAPPING" default:"0=pass,*=fail"`
+	// How many bytes of stdout and of stderr of a script are kept for the finished event (0 = no limit). Longer output keeps its beginning and end
+	ScriptOutputLimit int `envconfig:"SCRIPT_OUTPUT_LIMIT" default:"32768"`
+	// Default timeout of a request sent for a .http file (0 = no timeout). Can be overwritten per file with # @timeout
+	HttpTimeout time.Duration `envconfig:"HTTP_TIMEOUT" default:"30s"`
+	// Default number of retries for a failed request sent for a .http file. Can be overwritten per file with # @retries
+	HttpRetries int `envconfig:"HTTP_RETRIES" default:"0"`
+	// Default list of status codes that are retried. Can be overwritten per file with # @retry-on
+	HttpRetryOn []string `envconfig:"HTTP_RETRY_ON" default:"502,503,504"`
+	// Delay before the first retry which doubles with every further retry. Can be overwritten per file with # @retry-backoff
+	HttpRetryBackoff time.Duration `envconfig:"HTTP_RETRY_BACKOFF" default:"1s"`
+	// Where ${secret.name.key} and # @secret are resolved from: kubernetes, directory or none
+	SecretProvider string `envconfig:"SECRET_PROVIDER" default:"kubernetes"`
+	// Secrets that can be referenced, e.g: dynatrace,sockshop:slack-*,sockshop/production:pagerduty. Every other secret is rejected
+	SecretAllowlist []string `envconfig:"SECRET_ALLOWLIST" default:""`
+	// Directory with one subdirectory per secret if SECRET_PROVIDER=directory
+	SecretDirectory string `envconfig:"SECRET_DIRECTORY" default:"/etc/generic-executor/secrets"`
+	// Namespace to read k8s secrets from. Defaults to the namespace of the service account
+	PodNamespace string `envconfig:"POD_NAMESPACE" default:""`
+	// Env variables of the service that scripts and ${env.xxx} can access. Projects can allow more in generic-executor/env.allowlist
+	EnvAllowlist []string `envconfig:"ENV_ALLOWLIST" default:"PATH,HOME,HOSTNAME,LANG,LC_*,TZ,TMPDIR,PYTHON*"`
+	// Env variables that are never passed on, not even if a project allows them
+	EnvDenylist []string `envconfig:"ENV_DENYLIST" default:"*TOKEN*,*SECRET*,*PASSWORD*,*PASSWD*,*KEY*,*CREDENTIAL*,*AUTH*"`
+	// Maximum number of events that are handled at the same time
+	MaxConcurrency int `envconfig:"MAX_CONCURRENCY" default:"4"`
+	// Maximum number of events of the same project / service that are handled at the same time (0 = no limit)
+	MaxConcurrencyPerProject int `envconfig:"MAX_CONCURRENCY_PER_PROJECT" default:"0"`
+	MaxConcurrencyPerService int `envconfig:"MAX_CONCURRENCY_PER_SERVICE" default:"0"`
+	// Number of received events that can wait for a free worker
+	QueueSize int `envconfig:"QUEUE_SIZE" default:"100"`
+	// What happens to received events if the queue is full: reject (the event is not handled) or wait (the receiver blocks until there is room)
+	QueueFullPolicy string `envconfig:"QUEUE_FULL_POLICY" default:"wait"`
+	// Time running scripts and requests get to finish after SIGTERM before they are cancelled. Should be lower than terminationGracePeriodSeconds of the pod
+	ShutdownGracePeriod time.Duration `envconfig:"SHUTDOWN_GRACE_PERIOD" default:"50s"`
 }
 
 // ServiceName specifies the current services name (e.g., used as source when sending CloudEvents)
@@ -51,7 +105,7 @@ func parseKeptnCloudEventPayload(event cloudevents.Event, data interface{}) erro
  */
 func processKeptnCloudEvent(ctx context.Context, event cloudevents.Event) error {
 	// create keptn handler
-	log.Printf("Initializing Keptn Handler: local=%s, url=%s", keptnOptions.UseLocalFileSystem, keptnOptions.ConfigurationServiceURL)
+	log.Printf("Initializing Keptn Handler: local=%t, url=%s", keptnOptions.UseLocalFileSystem, keptnOptions.ConfigurationServiceURL)
 	myKeptn, err := keptnv2.NewKeptn(&event, keptnOptions)
 	if err != nil {
 		return errors.New("Could not create Keptn Handler: " + err.Error())
@@ -67,7 +121,18 @@ func processKeptnCloudEvent(ctx context.Context, event cloudevents.Event) error
 	eventData := &keptnv2.ProjectCreateStartedEventData{}
 	parseKeptnCloudEventPayload(event, eventData)
 
-	return GenericCloudEventsHandler(myKeptn, event, eventData)
+	// a configuration change must not wait in the queue until it invalidates the cached scripts of the project
+	invalidateResourceCacheForEvent(event.Type(), myKeptn.Event.GetProject())
+
+	// the event is handled asynchronously so that a long running script doesn't block the receiver
+	if err := eventWorkerPool.enqueue(eventJob{myKeptn: myKeptn, event: event, data: eventData}); err != nil {
+		queued, running := eventWorkerPool.stats()
+		log.Printf("Rejecting event %s: %s (%d queued, %d running)", event.Context.GetID(), err.Error(), queued, running)
+		observeEventReceived(event.Type(), false)
+		return err
+	}
+	observeEventReceived(event.Type(), true)
+	return nil
 }
 
 /**
@@ -102,28 +167,110 @@ func _main(args []string, env envConfig) int {
 	}
 
 	keptnOptions.ConfigurationServiceURL = env.ConfigurationServiceUrl
+	ResourceCacheTTL = env.ResourceCacheTTL
+	WorkspaceDirectory = env.WorkspaceDirectory
+	KeepWorkspaceOnFailure = env.KeepWorkspaceOnFailure
+
+	ScriptTimeout = env.ScriptTimeout
+	ScriptOutputLimit = env.ScriptOutputLimit
+	exitCodes, err := parseExitCodeMapping(env.ExitCodeMapping)
+	if err != nil {
+		log.Fatalf("Invalid EXIT_CODE_MAPPING: %s", err.Error())
+	}
+	ExitCodeMapping = ExitCodeMapping.merge(exitCodes)
+	if err := registerInterpreters(env.Interpreters); err != nil {
+		log.Fatalf("Invalid INTERPRETERS: %s", err.Error())
+	}
+	ExecutionMode = env.ExecutionMode
+	if ExecutionMode != ExecutionModeFirst && ExecutionMode != ExecutionModeAll {
+		log.Fatalf("Invalid EXECUTION_MODE %s: must be %s or %s", ExecutionMode, ExecutionModeFirst, ExecutionModeAll)
+	}
+	HttpTimeout = env.HttpTimeout
+	HttpRetries = env.HttpRetries
+	HttpRetryOn = env.HttpRetryOn
+	HttpRetryBackoff = env.HttpRetryBackoff
+	if UnresolvedPlaceholders, err = validateUnresolvedPlaceholdersPolicy(env.UnresolvedPlaceholders); err != nil {
+		log.Fatalf("Invalid UNRESOLVED_PLACEHOLDERS: %s", err.Error())
+	}
+	EnvAllowlist = env.EnvAllowlist
+	EnvDenylist = env.EnvDenylist
+
+	// values of secrets and sensitive env variables are masked in everything we log
+	registerSensitiveEnvValues()
+	log.SetOutput(&redactingWriter{out: os.Stderr})
+
+	provider, err := newSecretProvider(env.SecretProvider, env.PodNamespace, env.SecretDirectory)
+	if err != nil {
+		// we can still handle all scripts that don't need secrets
+		log.Printf("Secrets won't be available: %s", err.Error())
+	}
+	secretProvider = provider
+	SecretAllowlist = env.SecretAllowlist
+
+	eventWorkerPool, err = newWorkerPool(env.MaxConcurrency, env.QueueSize, env.QueueFullPolicy, env.MaxConcurrencyPerProject, env.MaxConcurrencyPerService, GenericCloudEventsHandler)
+	if err != nil {
+		log.Fatalf("failed to create worker pool, %v", err)
+	}
+	registerWorkerPoolMetrics(eventWorkerPool)
 
 	log.Println("Starting generic-executor...")
-	log.Printf("    on Port = %d; Path=%s", env.Port, env.Path)
+	log.Printf("    on Port = %d; Path=%s; Probes=/healthz,/readyz; Metrics=/metrics", env.Port, env.Path)
+	log.Printf("    Execution Mode = %s; Resource Cache TTL=%s", ExecutionMode, ResourceCacheTTL.String())
+	log.Printf("    Script Timeout = %s; Output Limit=%d; Interpreters=%v", ScriptTimeout.String(), ScriptOutputLimit, Interpreters)
+	log.Printf("    Exit Codes = %s", ExitCodeMapping.String())
+	log.Printf("    Workspace Directory = %s; KeepOnFailure=%t", WorkspaceDirectory, KeepWorkspaceOnFailure)
+	log.Printf("    Shutdown Grace Period = %s", env.ShutdownGracePeriod.String())
+	log.Printf("    Max Concurrency = %d; PerProject=%d; PerService=%d; QueueSize=%d; QueueFullPolicy=%s", env.MaxConcurrency, env.MaxConcurrencyPerProject, env.MaxConcurrencyPerService, env.QueueSize, env.QueueFullPolicy)
+	log.Printf("    Env Allowlist = %v; Denylist = %v", EnvAllowlist, EnvDenylist)
+	log.Printf("    HTTP Timeout = %s; Retries=%d; RetryOn=%v; RetryBackoff=%s; UnresolvedPlaceholders=%s", HttpTimeout.String(), HttpRetries, HttpRetryOn, HttpRetryBackoff.String(), UnresolvedPlaceholders)
 
 	ctx := context.Background()
 	ctx = cloudevents.WithEncodingStructured(ctx)
 
 	log.Printf("Creating new http handler")
 
-	// configure http server to receive cloudevents
-	p, err := cloudevents.NewHTTP(cloudevents.WithPath(env.Path), cloudevents.WithPort(env.Port))
-
+	// configure http handler to receive cloudevents - it is served together with /healthz, /readyz and /metrics
+	p, err := cloudevents.NewHTTP()
 	if err != nil {
 		log.Fatalf("failed to create client, %v", err)
 	}
-	c, err := cloudevents.NewClient(p)
+	receiver, err := cloudevents.NewHTTPReceiveHandler(ctx, p, processKeptnCloudEvent)
 	if err != nil {
-		log.Fatalf("failed to create client, %v", err)
+		log.Fatalf("failed to create handler, %v", err)
 	}
+	server := &http.Server{Addr: fmt.Sprintf(":%d", env.Port), Handler: newServeMux(env.Path, receiver)}
 
 	log.Printf("Starting receiver")
-	log.Fatal(c.StartReceiver(ctx, processKeptnCloudEvent))
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	setReady(true)
+
+	// SIGTERM (e.g: during a rollout) stops accepting events - the events we already accepted get the chance to finish
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	exitCode := 0
+	select {
+	case receivedSignal := <-signals:
+		log.Printf("Received %s - no longer accepting events", receivedSignal.String())
+	case err := <-serverErr:
+		log.Printf("Receiver stopped: %s", err.Error())
+		exitCode = 1
+	}
+	setReady(false)
+
+	// whether we received a signal or the receiver failed - the events we accepted still get their finished events
+	// the server keeps running in the meantime so that probes and metrics stay available, new events are rejected by the worker pool
+	if !eventWorkerPool.shutdown(env.ShutdownGracePeriod) {
+		log.Printf("Not all events finished within %s - they were cancelled", env.ShutdownGracePeriod.String())
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), processKillGracePeriod)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	log.Printf("Shut down generic-executor")
 
-	return 0
+	return exitCode
 }
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestFile is the optional resource that maps events to the scripts that should be executed for them
+const ManifestFile = GenericScriptFolderBase + "generic-executor.yaml"
+
+// executorManifest is the content of generic-executor.yaml, e.g:
+//
+// mode: all
+// interpreters:
+//   .js: node
+// events:
+//   test.triggered:
+//     - script: tests/smoke.http
+//     - script: tests/load.py
+//       interpreter: python3 -u
+//       args: ["--users", "10"]
+//       env:
+//         TARGET: ${data.project}
+//       timeout: 10m
+//       exitCodes:
+//         2: warning
+//         3: fail/errored
+//       when:
+//         data.stage: production|staging
+type executorManifest struct {
+	// Mode overwrites EXECUTION_MODE: first or all
+	Mode string `yaml:"mode"`
+	// Interpreters for additional extensions or to overwrite INTERPRETERS, e.g: .js: node
+	Interpreters map[string]string           `yaml:"interpreters"`
+	Events       map[string][]manifestAction `yaml:"events"`
+}
+
+// manifestAction is an entry of an event in generic-executor.yaml
+type manifestAction struct {
+	// Script path relative to generic-executor/
+	Script string `yaml:"script"`
+	// Interpreter command incl. its arguments, e.g: python3 -u. Defaults to the interpreter for the extension of the script
+	Interpreter string `yaml:"interpreter"`
+	// Args are passed to the script after the event file
+	Args []string `yaml:"args"`
+	// Env variables that are passed in addition to the ones from the event. Values can contain placeholders such as ${data.project}
+	Env map[string]string `yaml:"env"`
+	// Timeout overwrites # @timeout of the script and SCRIPT_TIMEOUT
+	Timeout string `yaml:"timeout"`
+	// ExitCodes extends # @exit-codes of the script and EXIT_CODE_MAPPING, e.g: 2: warning
+	ExitCodes map[string]string `yaml:"exitCodes"`
+	// When contains conditions on event fields, e.g: data.stage: production. The value is a regular expression that has to match the whole field
+	When map[string]string `yaml:"when"`
+}
+
+// scriptAction is a script or .http file that gets executed for an event - either found via generic-executor.yaml or the file name conventions
+type scriptAction struct {
+	// name of the resource, e.g: generic-executor/test.triggered.sh
+	name string
+	// level the resource was taken from if all scripts are executed - see ExecutionModeAll
+	level string
+	// file is where the resource was stored locally
+	file string
+	// directory the script is executed in - see materializeScriptDirectory. Empty for the current directory
+	directory   string
+	interpreter []string
+	args        []string
+	env         map[string]string
+	timeout     time.Duration
+	// exitCodes decide about result and status of the script - see ExitCodeMapping
+	exitCodes exitCodeMapping
+	// reportStatus sends the progress the script reports as status.changed event. nil if no events are sent for the incoming event
+	reportStatus func(message string)
+}
+
+//
+// Returns a scriptAction with the default interpreter, args and timeout for a script that was found via the file name conventions
+//
+func newScriptAction(name string, file string) scriptAction {
+	return scriptAction{name: name, file: file, env: map[string]string{}, timeout: getScriptTimeout(file), exitCodes: getScriptExitCodes(file)}
+}
+
+//
+// Parses generic-executor.yaml. Event names are normalized so that sh.keptn.event.test.triggered and test.triggered are the same
+//
+func parseExecutorManifest(content []byte) (executorManifest, error) {
+	manifest := executorManifest{}
+	if err := yaml.UnmarshalStrict(content, &manifest); err != nil {
+		return manifest, fmt.Errorf("Invalid %s: %s", ManifestFile, err.Error())
+	}
+	if manifest.Mode != "" && manifest.Mode != ExecutionModeFirst && manifest.Mode != ExecutionModeAll {
+		return manifest, fmt.Errorf("Invalid %s: mode %s must be %s or %s", ManifestFile, manifest.Mode, ExecutionModeFirst, ExecutionModeAll)
+	}
+
+	for extension, command := range normalizeInterpreters(manifest.Interpreters) {
+		if extension == ".http" || strings.TrimSpace(command) == "" {
+			return manifest, fmt.Errorf("Invalid %s: interpreter %s for %s", ManifestFile, command, extension)
+		}
+	}
+
+	events := map[string][]manifestAction{}
+	for eventName, actions := range manifest.Events {
+		eventName = strings.TrimPrefix(eventName, "sh.keptn.event.")
+		for ix, action := range actions {
+			if action.Script == "" {
+				return manifest, fmt.Errorf("Invalid %s: action %d of %s has no script", ManifestFile, ix+1, eventName)
+			}
+			if _, err := manifestScriptName(action.Script); err != nil {
+				return manifest, fmt.Errorf("Invalid %s: %s", ManifestFile, err.Error())
+			}
+			if action.Timeout != "" {
+				if _, err := time.ParseDuration(action.Timeout); err != nil {
+					return manifest, fmt.Errorf("Invalid %s: timeout %s of %s: %s", ManifestFile, action.Timeout, action.Script, err.Error())
+				}
+			}
+			if _, err := parseManifestExitCodes(action.ExitCodes); err != nil {
+				return manifest, fmt.Errorf("Invalid %s: exit codes of %s: %s", ManifestFile, action.Script, err.Error())
+			}
+			for field, pattern := range action.When {
+				if _, err := regexp.Compile("^(?:" + pattern + ")$"); err != nil {
+					return manifest, fmt.Errorf("Invalid %s: condition %s of %s: %s", ManifestFile, field, action.Script, err.Error())
+				}
+			}
+		}
+		events[eventName] = append(events[eventName], actions...)
+	}
+	manifest.Events = events
+	return manifest, nil
+}
+
+//
+// Loads generic-executor.yaml from service, stage or project level. Returns false if there is none
+//
+func loadExecutorManifest(myKeptn *keptnv2.Keptn, uniquePrefix string) (executorManifest, bool, error) {
+	manifestFile, err := getKeptnResource(myKeptn, ManifestFile, uniquePrefix)
+	if err != nil || manifestFile == "" {
+		return executorManifest{}, false, nil
+	}
+
+	content, err := ioutil.ReadFile(manifestFile)
+	if err != nil {
+		return executorManifest{}, false, err
+	}
+
+	manifest, err := parseExecutorManifest(content)
+	return manifest, err == nil, err
+}
+
+//
+// Returns the actions of generic-executor.yaml whose conditions match the event and stores their scripts locally
+// The second return value is false if the manifest doesn't list any of the event names - then the file name conventions apply
+//
+func getManifestScriptActions(myKeptn *keptnv2.Keptn, manifest executorManifest, eventNames []string, incomingEvent cloudevents.Event, serviceEnvVariables []string, uniquePrefix string) ([]scriptAction, bool, error) {
+	eventFields := map[string]interface{}{}
+	if err := keptnv2.Decode(incomingEvent, &eventFields); err != nil {
+		return nil, false, err
+	}
+
+	listed := false
+	actions := []scriptAction{}
+	for _, eventName := range eventNames {
+		manifestActions, exists := manifest.Events[eventName]
+		if !exists {
+			continue
+		}
+		listed = true
+
+		for _, manifestAction := range manifestActions {
+			if !matchesEventConditions(manifestAction.When, eventFields) {
+				log.Printf("Skipping %s for %s as its conditions don't match", manifestAction.Script, eventName)
+				continue
+			}
+
+			action, err := newManifestScriptAction(myKeptn, manifestAction, incomingEvent, serviceEnvVariables, uniquePrefix)
+			if err != nil {
+				return nil, true, err
+			}
+			actions = append(actions, action)
+		}
+	}
+	return actions, listed, nil
+}
+
+//
+// Returns the resource name of a script referenced in generic-executor.yaml, e.g: tests/smoke.http -> generic-executor/tests/smoke.http
+// The script is stored in the workspace under that name - so absolute paths and paths outside of generic-executor/ are rejected
+//
+func manifestScriptName(script string) (string, error) {
+	if path.IsAbs(script) || strings.Contains(script, `\`) {
+		return "", fmt.Errorf("Script %s must be a path relative to %s separated by /", script, GenericScriptFolderBase)
+	}
+	name := path.Clean(GenericScriptFolderBase + strings.TrimPrefix(script, GenericScriptFolderBase))
+	if !strings.HasPrefix(name, GenericScriptFolderBase) {
+		return "", fmt.Errorf("Script %s is outside of %s", script, GenericScriptFolderBase)
+	}
+	return name, nil
+}
+
+//
+// Stores the script of a manifestAction locally and returns the scriptAction to execute it
+//
+func newManifestScriptAction(myKeptn *keptnv2.Keptn, manifestAction manifestAction, incomingEvent cloudevents.Event, serviceEnvVariables []string, uniquePrefix string) (scriptAction, error) {
+	name, err := manifestScriptName(manifestAction.Script)
+	if err != nil {
+		return scriptAction{}, err
+	}
+	file, err := getKeptnResource(myKeptn, name, uniquePrefix)
+	if err != nil || file == "" {
+		return scriptAction{}, fmt.Errorf("Script %s referenced in %s not found", name, ManifestFile)
+	}
+	log.Printf("Found script %s via %s and stored it as %s", name, ManifestFile, file)
+
+	action := newScriptAction(name, file)
+	action.interpreter = strings.Fields(manifestAction.Interpreter)
+	action.args = manifestAction.Args
+	if manifestAction.Timeout != "" {
+		action.timeout, _ = time.ParseDuration(manifestAction.Timeout)
+	}
+	exitCodes, _ := parseManifestExitCodes(manifestAction.ExitCodes)
+	action.exitCodes = action.exitCodes.merge(exitCodes)
+	for key, value := range manifestAction.Env {
+		action.env[key], _ = manageKeptnPlaceholders(value, incomingEvent, serviceEnvVariables)
+	}
+	return action, nil
+}
+
+//
+// Returns true if all conditions match the fields of the event. A condition is a field path (e.g: data.stage) and a regular expression
+// Missing fields are treated as empty string so that a condition like "data.labels.skip: ''" matches if the label isn't set
+//
+func matchesEventConditions(conditions map[string]string, eventFields map[string]interface{}) bool {
+	// sorted to always log the same condition
+	fields := []string{}
+	for field := range conditions {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		value, exists, err := evaluateJSONPath(eventFields, "$."+strings.TrimPrefix(field, "$."))
+		if err != nil {
+			log.Printf("Invalid condition %s: %s", field, err.Error())
+			return false
+		}
+
+		valueString := ""
+		if exists && value != nil {
+			valueString = fmt.Sprintf("%v", value)
+		}
+
+		if !regexp.MustCompile("^(?:" + conditions[field] + ")$").MatchString(valueString) {
+			return false
+		}
+	}
+	return true
+}
+
+//
+// Parses the exitCodes of an action in generic-executor.yaml, e.g: 2: warning
+//
+func parseManifestExitCodes(exitCodes map[string]string) (exitCodeMapping, error) {
+	entries := []string{}
+	for exitCode, outcome := range exitCodes {
+		entries = append(entries, exitCode+"="+outcome)
+	}
+	return parseExitCodeMapping(strings.Join(entries, ","))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func Test_parseExecutorManifest(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		wantEvents []string
+		wantErr    bool
+	}{
+		{
+			name: "short and full event names",
+			content: `
+events:
+  test.triggered:
+    - script: test.triggered.sh
+  sh.keptn.event.deployment.triggered:
+    - script: deployment.triggered.http
+      timeout: 1m
+`,
+			wantEvents: []string{"test.triggered", "deployment.triggered"},
+		},
+		{name: "missing script", content: "events:\n  test.triggered:\n    - interpreter: bash\n", wantErr: true},
+		{name: "invalid timeout", content: "events:\n  test.triggered:\n    - script: a.sh\n      timeout: soon\n", wantErr: true},
+		{name: "invalid condition", content: "events:\n  test.triggered:\n    - script: a.sh\n      when:\n        data.stage: '('\n", wantErr: true},
+		{name: "exit codes", content: "events:\n  test.triggered:\n    - script: a.sh\n      exitCodes:\n        2: warning\n        3: fail/errored\n", wantEvents: []string{"test.triggered"}},
+		{name: "invalid exit codes", content: "events:\n  test.triggered:\n    - script: a.sh\n      exitCodes:\n        2: maybe\n", wantErr: true},
+		{name: "unknown field", content: "events:\n  test.triggered:\n    - script: a.sh\n      interpeter: bash\n", wantErr: true},
+		{name: "script outside of generic-executor", content: "events:\n  test.triggered:\n    - script: ../../../tmp/x\n", wantErr: true},
+		{name: "absolute script", content: "events:\n  test.triggered:\n    - script: /etc/passwd\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest, err := parseExecutorManifest([]byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExecutorManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, eventName := range tt.wantEvents {
+				if _, exists := manifest.Events[eventName]; !exists {
+					t.Errorf("parseExecutorManifest() = %v, missing %s", manifest.Events, eventName)
+				}
+			}
+		})
+	}
+}
+
+func Test_matchesEventConditions(t *testing.T) {
+	eventFields := map[string]interface{}{
+		"data": map[string]interface{}{
+			"stage":  "production",
+			"labels": map[string]interface{}{"team": "checkout"},
+			"result": map[string]interface{}{"count": float64(3)},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		conditions map[string]string
+		want       bool
+	}{
+		{name: "no conditions", conditions: map[string]string{}, want: true},
+		{name: "exact match", conditions: map[string]string{"data.stage": "production"}, want: true},
+		{name: "alternatives", conditions: map[string]string{"data.stage": "staging|production"}, want: true},
+		{name: "whole value must match", conditions: map[string]string{"data.stage": "prod"}, want: false},
+		{name: "all conditions must match", conditions: map[string]string{"data.stage": "production", "data.labels.team": "carts"}, want: false},
+		{name: "number", conditions: map[string]string{"data.result.count": "[1-5]"}, want: true},
+		{name: "missing field is empty", conditions: map[string]string{"data.labels.skip": ""}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesEventConditions(tt.conditions, eventFields); got != tt.want {
+				t.Errorf("matchesEventConditions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getManifestScriptActions(t *testing.T) {
+	manifest, err := parseExecutorManifest([]byte(`
+events:
+  test.triggered:
+    - script: test.triggered.sh
+      interpreter: bash -x
+      args: ["--fast"]
+      env:
+        PROJECT: ${data.project}
+      timeout: 2m
+    - script: generic-executor/test.triggered.http
+      when:
+        data.stage: production
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop", "stage": "dev", "service": "carts"})
+	myKeptn, err := keptnv2.NewKeptn(&event, keptn.KeptnOpts{UseLocalFileSystem: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions, listed, err := getManifestScriptActions(myKeptn, manifest, []string{"test.triggered"}, event, []string{}, "test")
+	if err != nil || !listed {
+		t.Fatalf("getManifestScriptActions() = %v, %v", listed, err)
+	}
+	// the .http action only runs in production
+	if len(actions) != 1 {
+		t.Fatalf("getManifestScriptActions() returned %d actions, want 1", len(actions))
+	}
+	action := actions[0]
+	if action.name != "generic-executor/test.triggered.sh" || action.timeout != 2*time.Minute || action.env["PROJECT"] != "sockshop" ||
+		len(action.interpreter) != 2 || action.interpreter[1] != "-x" || len(action.args) != 1 {
+		t.Errorf("getManifestScriptActions() = %+v", action)
+	}
+
+	_, listed, _ = getManifestScriptActions(myKeptn, manifest, []string{"deployment.triggered"}, event, []string{}, "test")
+	if listed {
+		t.Errorf("getManifestScriptActions() listed deployment.triggered")
+	}
+}
+
+func Test_manifestScriptName(t *testing.T) {
+	tests := []struct {
+		script  string
+		want    string
+		wantErr bool
+	}{
+		{script: "tests/smoke.http", want: "generic-executor/tests/smoke.http"},
+		{script: "generic-executor/test.triggered.sh", want: "generic-executor/test.triggered.sh"},
+		{script: "tests/../test.triggered.sh", want: "generic-executor/test.triggered.sh"},
+		{script: "../../../tmp/x", wantErr: true},
+		{script: "tests/../../x.sh", wantErr: true},
+		{script: "generic-executor/../x.sh", wantErr: true},
+		{script: "..", wantErr: true},
+		{script: "/tmp/x.sh", wantErr: true},
+		{script: `..\..\x.sh`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.script, func(t *testing.T) {
+			got, err := manifestScriptName(tt.script)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("manifestScriptName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("manifestScriptName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
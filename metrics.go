@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsNamespace prefixes all metrics of the service, e.g: generic_executor_events_received_total
+const metricsNamespace = "generic_executor"
+
+var (
+	eventsReceivedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_received_total",
+		Help:      "Number of received events by type and whether they were accepted or rejected",
+	}, []string{"type", "accepted"})
+
+	scriptsExecutedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "scripts_executed_total",
+		Help:      "Number of executed scripts and .http files by extension, result and status",
+	}, []string{"extension", "result", "status"})
+
+	executionDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "execution_duration_seconds",
+		Help:      "Duration of script and .http file executions by extension",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 1800},
+	}, []string{"extension"})
+
+	httpRequestsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Number of requests sent for .http files by status code (error if no response was received). Every retry is counted",
+	}, []string{"status_code"})
+
+	resourceFetchDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "resource_fetch_duration_seconds",
+		Help:      "Latency of fetching resources from the configuration service by level (service, stage, project) and whether the resource was found",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"level", "found"})
+
+	resourceCacheCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "resource_cache_lookups_total",
+		Help:      "Number of resource lookups answered from the resource cache (hit) or the configuration service (miss)",
+	}, []string{"result"})
+)
+
+// metricsEventTasks are the Keptn tasks whose events are counted by type - events of other tasks are counted as other
+var metricsEventTasks = []string{
+	"deployment", "test", "evaluation", "release", "rollback", "approval", "action", "remediation", "get-action", "get-sli",
+	"configure-monitoring", "monitoring", "problem", "project.create", "project.delete", "service.create", "service.delete",
+}
+
+// metricsEventPhases are the phases of a task event, e.g: sh.keptn.event.test.triggered
+var metricsEventPhases = []string{"triggered", "started", "status.changed", "finished"}
+
+// ready is 1 once the service accepts events and 0 again when it shuts down
+var ready int32
+
+func init() {
+	prometheus.MustRegister(eventsReceivedCounter, scriptsExecutedCounter, executionDurationHistogram, httpRequestsCounter, resourceFetchDurationHistogram, resourceCacheCounter)
+}
+
+//
+// Registers the queue depth and the number of running events of the worker pool as gauges
+//
+func registerWorkerPoolMetrics(pool *workerPool) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "queue_depth",
+		Help:      "Number of received events waiting for a free worker",
+	}, func() float64 {
+		queued, _ := pool.stats()
+		return float64(queued)
+	}))
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "running_events",
+		Help:      "Number of events that are currently handled",
+	}, func() float64 {
+		_, running := pool.stats()
+		return float64(running)
+	}))
+}
+
+//
+// Records a received event and whether it was queued or rejected
+//
+func observeEventReceived(eventType string, accepted bool) {
+	eventsReceivedCounter.WithLabelValues(metricsEventType(eventType), strconv.FormatBool(accepted)).Inc()
+}
+
+//
+// Returns the type label of an event: its type if it is sh.keptn.event.<task>.<phase> of a known task and phase - otherwise other
+// Anyone who can reach the receiver decides about the type - so it must not end up as label as it is
+//
+func metricsEventType(eventType string) string {
+	for _, task := range metricsEventTasks {
+		for _, phase := range metricsEventPhases {
+			if eventType == "sh.keptn.event."+task+"."+phase {
+				return eventType
+			}
+		}
+	}
+	return "other"
+}
+
+//
+// Records the outcome of executing a script or .http file
+//
+func observeScriptExecution(action scriptAction, result keptnv2.ResultType, status keptnv2.StatusType, duration time.Duration) {
+	extension := metricsExtension(action)
+	scriptsExecutedCounter.WithLabelValues(extension, string(result), string(status)).Inc()
+	executionDurationHistogram.WithLabelValues(extension).Observe(duration.Seconds())
+}
+
+//
+// Returns the extension label of an action: .http, .http.tmpl or an extension registered in INTERPRETERS - otherwise other
+// Script names come from the repositories of the projects, e.g: deploy.triggered.remediate - so they must not end up as label as they are
+//
+func metricsExtension(action scriptAction) string {
+	if strings.HasSuffix(action.name, httpTemplateExtension) {
+		return httpTemplateExtension
+	}
+	extension := strings.ToLower(filepath.Ext(action.name))
+	if _, registered := Interpreters[extension]; registered || extension == ".http" {
+		return extension
+	}
+	return "other"
+}
+
+//
+// Records a single attempt of a request sent for a .http file
+//
+func observeHttpRequest(statusCode int, err error) {
+	statusCodeLabel := strconv.Itoa(statusCode)
+	if err != nil {
+		statusCodeLabel = "error"
+	}
+	httpRequestsCounter.WithLabelValues(statusCodeLabel).Inc()
+}
+
+//
+// Records the latency of looking up a resource on service, stage or project level
+//
+func observeResourceFetch(level string, found bool, start time.Time) {
+	resourceFetchDurationHistogram.WithLabelValues(level, strconv.FormatBool(found)).Observe(time.Since(start).Seconds())
+}
+
+//
+// Records whether a resource lookup was answered from the resource cache
+//
+func observeResourceCacheLookup(hit bool) {
+	if hit {
+		resourceCacheCounter.WithLabelValues("hit").Inc()
+	} else {
+		resourceCacheCounter.WithLabelValues("miss").Inc()
+	}
+}
+
+func setReady(isReady bool) {
+	if isReady {
+		atomic.StoreInt32(&ready, 1)
+	} else {
+		atomic.StoreInt32(&ready, 0)
+	}
+}
+
+//
+// Returns a mux with /healthz, /readyz and /metrics. receiver handles the cloud events on receiverPath
+//
+func newServeMux(receiverPath string, receiver http.Handler) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle(receiverPath, receiver)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	// the service is healthy as long as it can answer
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	// the service is ready if it accepts events and its queue isn't full
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&ready) == 0 {
+			http.Error(w, "not accepting events", http.StatusServiceUnavailable)
+			return
+		}
+		if eventWorkerPool != nil && eventWorkerPool.isFull() {
+			http.Error(w, "queue is full", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	return mux
+}
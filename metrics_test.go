@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_newServeMux(t *testing.T) {
+	receiver := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("event"))
+	})
+	server := httptest.NewServer(newServeMux("/", receiver))
+	defer server.Close()
+
+	// the counters are global - so other tests and earlier runs may have counted requests already
+	before := testutil.ToFloat64(httpRequestsCounter.WithLabelValues("418"))
+	observeHttpRequest(418, nil)
+	if got := testutil.ToFloat64(httpRequestsCounter.WithLabelValues("418")) - before; got != 1 {
+		t.Errorf("observeHttpRequest() counted %v requests, want 1", got)
+	}
+
+	tests := []struct {
+		name         string
+		ready        bool
+		path         string
+		wantStatus   int
+		wantContains string
+	}{
+		{name: "healthy", path: "/healthz", wantStatus: 200, wantContains: "ok"},
+		{name: "not ready", ready: false, path: "/readyz", wantStatus: 503},
+		{name: "ready", ready: true, path: "/readyz", wantStatus: 200, wantContains: "ok"},
+		{name: "metrics", path: "/metrics", wantStatus: 200, wantContains: `generic_executor_http_requests_total{status_code="418"}`},
+		{name: "cloud events", path: "/", wantStatus: 200, wantContains: "event"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setReady(tt.ready)
+			defer setReady(false)
+
+			resp, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("GET %s = %d, want %d", tt.path, resp.StatusCode, tt.wantStatus)
+			}
+			if !strings.Contains(string(body), tt.wantContains) {
+				t.Errorf("GET %s = %s, want it to contain %s", tt.path, body, tt.wantContains)
+			}
+		})
+	}
+}
+
+func Test_metricsExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "generic-executor/test.triggered.sh", want: ".sh"},
+		{name: "generic-executor/test.triggered.PY", want: ".py"},
+		{name: "generic-executor/test.triggered.http", want: ".http"},
+		{name: "generic-executor/test.triggered.http.tmpl", want: ".http.tmpl"},
+		{name: "generic-executor/deploy.triggered.remediate", want: "other"},
+		{name: "generic-executor/tests/load.js", want: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metricsExtension(scriptAction{name: tt.name}); got != tt.want {
+				t.Errorf("metricsExtension() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_metricsEventType(t *testing.T) {
+	tests := []struct {
+		eventType string
+		want      string
+	}{
+		{eventType: "sh.keptn.event.deployment.triggered", want: "sh.keptn.event.deployment.triggered"},
+		{eventType: "sh.keptn.event.test.status.changed", want: "sh.keptn.event.test.status.changed"},
+		{eventType: "sh.keptn.event.project.create.finished", want: "sh.keptn.event.project.create.finished"},
+		{eventType: "sh.keptn.event.my-custom-task.triggered", want: "other"},
+		{eventType: "sh.keptn.event.test.exploded", want: "other"},
+		{eventType: "a3f9c1e2-arbitrary-type", want: "other"},
+		{eventType: "", want: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.eventType, func(t *testing.T) {
+			if got := metricsEventType(tt.eventType); got != tt.want {
+				t.Errorf("metricsEventType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+)
+
+const (
+	// UnresolvedPlaceholdersError doesn't send any request of a .http file that references fields the event doesn't have
+	UnresolvedPlaceholdersError = "error"
+	// UnresolvedPlaceholdersWarn sends unresolved placeholders as they are and logs a warning
+	UnresolvedPlaceholdersWarn = "warn"
+	// UnresolvedPlaceholdersEmpty replaces unresolved placeholders with empty strings
+	UnresolvedPlaceholdersEmpty = "empty"
+)
+
+// UnresolvedPlaceholders is the default policy for placeholders that can't be resolved. A .http file can set its own with # @unresolved
+var UnresolvedPlaceholders = UnresolvedPlaceholdersWarn
+
+// httpPlaceholderPattern matches ${path}, ${raw:path} and ${json:path} in .http files. raw: inserts the value without escaping it, json: inserts it as JSON
+var httpPlaceholderPattern = regexp.MustCompile(`\$\{(raw:|json:)?([^{}]+)\}`)
+
+// jsonPlaceholderPattern matches ${json:path} in env values of generic-executor.yaml
+var jsonPlaceholderPattern = regexp.MustCompile(`\$\{json:([^{}]+)\}`)
+
+// headerLineBreaks are replaced in values inserted into headers so that a value can't add headers or end them
+var headerLineBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// httpPlaceholders resolves the placeholders of a .http file: fields of the event, ${env.xxx}, ${secret.name.key} and the time of the event
+type httpPlaceholders struct {
+	values map[string]string
+	// eventFields is the decoded event for ${json:path}
+	eventFields map[string]interface{}
+	secrets     *secretValues
+	// policy decides what happens with placeholders that can't be resolved - see UnresolvedPlaceholders
+	policy string
+	// unresolved are the placeholders that couldn't be resolved, e.g: ${data.deployment.gitcommit}
+	unresolved []string
+}
+
+// unresolvedPlaceholdersError lists the placeholders of a .http file that couldn't be resolved
+type unresolvedPlaceholdersError struct {
+	placeholders []string
+}
+
+func (e *unresolvedPlaceholdersError) Error() string {
+	return fmt.Sprintf("Unresolved placeholders: %s", strings.Join(e.placeholders, ", "))
+}
+
+// placeholderContext is the part of a request a placeholder is in. It decides how the value is escaped
+type placeholderContext int
+
+const (
+	// bodies that are neither JSON nor a form
+	contextVerbatim placeholderContext = iota
+	// comments and directives - unresolved placeholders in them are ignored
+	contextComment
+	contextRequestLine
+	// lines that continue the query string of the request line, e.g: &stage=${data.stage}
+	contextQuery
+	contextHeader
+	contextJSONBody
+	contextFormBody
+)
+
+//
+// Collects the values of all placeholders a .http file can reference for an event
+//
+func newHttpPlaceholders(incomingEvent cloudevents.Event, serviceEnvVariables []string) (*httpPlaceholders, error) {
+	values := map[string]string{
+		"timestring":    incomingEvent.Time().String(),
+		"timeutcstring": incomingEvent.Time().UTC().String(),
+		"timeutcms":     strconv.FormatInt(incomingEvent.Time().UTC().UnixNano()/1000000, 10),
+	}
+
+	// only the env variables we are allowed to pass on - see getExposedEnvVariables
+	for _, envVariable := range serviceEnvVariables {
+		pair := strings.SplitN(envVariable, "=", 2)
+		if len(pair) == 2 {
+			values["env."+strings.ToLower(pair[0])] = pair[1]
+		}
+	}
+
+	eventFields, err := decodePlaceholderFields(incomingEvent)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode incomingEvent: %s", err.Error())
+	}
+	collectPlaceholderValues(values, "", eventFields)
+
+	return &httpPlaceholders{values: values, eventFields: eventFields, secrets: newSecretValues(newSecretScope(incomingEvent)), policy: UnresolvedPlaceholders}, nil
+}
+
+//
+// Returns the policy for unresolved placeholders of a .http file: the one set via # @unresolved or UnresolvedPlaceholders
+//
+func getUnresolvedPlaceholdersPolicy(content string) (string, error) {
+	policy, ok := parseScriptDirectives(content)["unresolved"]
+	if !ok {
+		return UnresolvedPlaceholders, nil
+	}
+	return validateUnresolvedPlaceholdersPolicy(policy)
+}
+
+func validateUnresolvedPlaceholdersPolicy(policy string) (string, error) {
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	switch policy {
+	case UnresolvedPlaceholdersError, UnresolvedPlaceholdersWarn, UnresolvedPlaceholdersEmpty:
+		return policy, nil
+	}
+	return "", fmt.Errorf("Invalid policy for unresolved placeholders %s: must be %s, %s or %s", policy, UnresolvedPlaceholdersError, UnresolvedPlaceholdersWarn, UnresolvedPlaceholdersEmpty)
+}
+
+//
+// Applies the policy to the placeholders that couldn't be resolved: returns an unresolvedPlaceholdersError or logs a warning
+//
+func (p *httpPlaceholders) checkUnresolved() error {
+	if len(p.unresolved) == 0 {
+		return nil
+	}
+	switch p.policy {
+	case UnresolvedPlaceholdersError:
+		return &unresolvedPlaceholdersError{placeholders: p.unresolved}
+	case UnresolvedPlaceholdersEmpty:
+		log.Printf("Replaced unresolved placeholders with empty strings: %s", strings.Join(p.unresolved, ", "))
+	default:
+		log.Printf("Warning: sending unresolved placeholders as they are: %s", strings.Join(p.unresolved, ", "))
+	}
+	return nil
+}
+
+//
+// Remembers a placeholder that couldn't be resolved - every placeholder only once
+//
+func (p *httpPlaceholders) addUnresolved(placeholder string) {
+	for _, unresolved := range p.unresolved {
+		if unresolved == placeholder {
+			return
+		}
+	}
+	p.unresolved = append(p.unresolved, placeholder)
+}
+
+//
+// Decodes the fields of an event for placeholders. Numbers are kept as they are in the event so that e.g: large IDs don't lose precision
+//
+func decodePlaceholderFields(incomingEvent cloudevents.Event) (map[string]interface{}, error) {
+	eventAsJSON, err := json.Marshal(incomingEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	eventFields := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(eventAsJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&eventFields); err != nil {
+		return nil, err
+	}
+	return eventFields, nil
+}
+
+//
+// Adds the strings, numbers and booleans of the event with their full path, e.g: data.project or data.deployment.deploymentURIsPublic[0]
+//
+func collectPlaceholderValues(values map[string]string, keyPath string, value interface{}) {
+	if stringValue, ok := placeholderString(value); ok {
+		if keyPath != "" {
+			values[keyPath] = stringValue
+		}
+		return
+	}
+
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typedValue {
+			if keyPath != "" {
+				key = keyPath + "." + key
+			}
+			collectPlaceholderValues(values, key, child)
+		}
+	case []interface{}:
+		if keyPath == "" {
+			return
+		}
+		for index, child := range typedValue {
+			collectPlaceholderValues(values, fmt.Sprintf("%s[%d]", keyPath, index), child)
+		}
+	}
+}
+
+//
+// Returns a field of an event as it is inserted for a placeholder: numbers and booleans in their canonical form, e.g: 1234 or true
+// The second return value is false for objects, arrays and null
+//
+func placeholderString(value interface{}) (string, bool) {
+	switch typedValue := value.(type) {
+	case string:
+		return typedValue, true
+	case bool:
+		return strconv.FormatBool(typedValue), true
+	case float64:
+		return strconv.FormatFloat(typedValue, 'f', -1, 64), true
+	case json.Number:
+		return typedValue.String(), true
+	default:
+		return "", false
+	}
+}
+
+//
+// Returns the field at a path of the event as JSON, e.g: data.labels for ${json:data.labels}. The second return value is false if the field doesn't exist
+//
+func placeholderJSON(eventFields map[string]interface{}, path string) (string, bool, error) {
+	value, exists, err := evaluateJSONPath(eventFields, "$."+path)
+	if err != nil || !exists {
+		return "", false, err
+	}
+
+	valueAsJSON := bytes.Buffer{}
+	encoder := json.NewEncoder(&valueAsJSON)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", false, err
+	}
+	return strings.TrimSuffix(valueAsJSON.String(), "\n"), true, nil
+}
+
+//
+// Returns the value of a placeholder. The second return value is false if there is no such value
+//
+func (p *httpPlaceholders) lookup(path string) (string, bool, error) {
+	if strings.HasPrefix(path, "secret.") {
+		// the name ends at the first dot as keys (e.g: tls.crt) may contain dots
+		secretPath := strings.SplitN(strings.TrimPrefix(path, "secret."), ".", 2)
+		if len(secretPath) != 2 {
+			return "", false, fmt.Errorf("Invalid secret reference %s: must be secret.name.key", path)
+		}
+		value, err := p.secrets.get(secretPath[0], secretPath[1])
+		return value, err == nil, err
+	}
+
+	value, exists := p.values[path]
+	return value, exists, nil
+}
+
+//
+// Replaces all placeholders in one line and escapes their values for the context the line is in
+// Every placeholder is only replaced once, so values from the event can never reference a secret
+//
+func (p *httpPlaceholders) replace(line string, context placeholderContext) (string, error) {
+	var lookupErr error
+	resolved := bytes.Buffer{}
+	lastEnd := 0
+	for _, match := range httpPlaceholderPattern.FindAllStringSubmatchIndex(line, -1) {
+		prefix := ""
+		if match[2] >= 0 {
+			prefix = line[match[2]:match[3]]
+		}
+		path := line[match[4]:match[5]]
+
+		var value string
+		var exists bool
+		var err error
+		if prefix == "json:" {
+			value, exists, err = placeholderJSON(p.eventFields, path)
+		} else {
+			value, exists, err = p.lookup(path)
+		}
+		if err != nil && lookupErr == nil {
+			lookupErr = err
+		}
+
+		resolved.WriteString(line[lastEnd:match[0]])
+		switch {
+		case !exists && context == contextComment:
+			resolved.WriteString(line[match[0]:match[1]])
+		case !exists:
+			// e.g: placeholders of fields that aren't part of this event - with the warn policy we send them as they are
+			if err == nil {
+				p.addUnresolved(line[match[0]:match[1]])
+			}
+			if p.policy != UnresolvedPlaceholdersEmpty {
+				resolved.WriteString(line[match[0]:match[1]])
+			}
+		case prefix == "raw:", prefix == "json:" && context == contextJSONBody:
+			resolved.WriteString(value)
+		default:
+			resolved.WriteString(context.escape(value, line[:match[0]]))
+		}
+		if VerboseLogging && exists {
+			log.Printf("${%s} --> %s", path, value)
+		}
+		lastEnd = match[1]
+	}
+	resolved.WriteString(line[lastEnd:])
+	return resolved.String(), lookupErr
+}
+
+//
+// Replaces the placeholders of a single request of a .http file. Each value is escaped for the part of the request it ends up in:
+// URL encoded in the request line, without line breaks in headers and JSON or form encoded in the body. Comments are left as they are
+//
+func (p *httpPlaceholders) resolveRequest(block string) (string, error) {
+	const (
+		beforeRequestLine = iota
+		inQuery
+		inHeaders
+		inBody
+	)
+	part := beforeRequestLine
+	contentType := ""
+	bodyContext, bodyStarted := contextVerbatim, false
+
+	lines := strings.Split(block, "\n")
+	for ix, line := range lines {
+		trimmedLine := strings.TrimSpace(line)
+
+		context := contextVerbatim
+		switch {
+		case part != inBody && isHttpComment(line), part == inBody && strings.HasPrefix(line, "#"):
+			// directives, e.g: # @assert body $.project == ${data.project}
+			context = contextComment
+		case part == beforeRequestLine && trimmedLine != "":
+			context = contextRequestLine
+			part = inQuery
+		case part == inQuery && (strings.HasPrefix(trimmedLine, "?") || strings.HasPrefix(trimmedLine, "&")):
+			context = contextQuery
+		case (part == inQuery || part == inHeaders) && trimmedLine == "":
+			part = inBody
+		case part == inQuery:
+			part = inHeaders
+			fallthrough
+		case part == inHeaders:
+			context = contextHeader
+			if headerParts := strings.SplitN(trimmedLine, ":", 2); len(headerParts) == 2 && strings.EqualFold(strings.TrimSpace(headerParts[0]), "Content-Type") {
+				contentType = strings.ToLower(headerParts[1])
+			}
+		case part == inBody && trimmedLine != "":
+			if !bodyStarted {
+				bodyContext, bodyStarted = getBodyContext(contentType, trimmedLine), true
+			}
+			context = bodyContext
+		}
+
+		resolvedLine, err := p.replace(line, context)
+		if err != nil {
+			return block, err
+		}
+		lines[ix] = resolvedLine
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+//
+// Returns how values are escaped in a body: JSON escaped for JSON, form encoded for forms and not at all for anything else
+// Without Content-Type a body that starts with { or [ is treated as JSON
+//
+func getBodyContext(contentType string, firstLine string) placeholderContext {
+	switch {
+	case strings.Contains(contentType, "json"):
+		return contextJSONBody
+	case strings.Contains(contentType, "x-www-form-urlencoded"):
+		return contextFormBody
+	case strings.TrimSpace(contentType) == "" && (strings.HasPrefix(firstLine, "{") || strings.HasPrefix(firstLine, "[")):
+		return contextJSONBody
+	default:
+		return contextVerbatim
+	}
+}
+
+//
+// Escapes a value for the part of the request it is inserted into. prefix is the part of the line in front of the placeholder
+//
+func (c placeholderContext) escape(value string, prefix string) string {
+	switch c {
+	case contextRequestLine:
+		return escapeForRequestLine(value, prefix)
+	case contextQuery:
+		return url.QueryEscape(value)
+	case contextHeader:
+		return headerLineBreaks.Replace(value)
+	case contextJSONBody:
+		return escapeForJSON(value)
+	case contextFormBody:
+		return url.QueryEscape(value)
+	default:
+		return value
+	}
+}
+
+//
+// Escapes a value for the request line: placeholders at the beginning of the URL or in its host are inserted as they are, e.g: ${data.deploymentURI}/health
+// Values in the path are path escaped and values in the query string query escaped
+//
+func escapeForRequestLine(value string, prefix string) string {
+	uriPrefix := prefix[strings.LastIndex(prefix, " ")+1:]
+	if strings.Contains(uriPrefix, "?") {
+		return url.QueryEscape(value)
+	}
+
+	hostAndPath := uriPrefix
+	if schemeEnd := strings.Index(uriPrefix, "://"); schemeEnd >= 0 {
+		hostAndPath = uriPrefix[schemeEnd+3:]
+	}
+	if !strings.Contains(hostAndPath, "/") {
+		return value
+	}
+	return url.PathEscape(value)
+}
+
+//
+// Escapes a value for a JSON string - the quotes around the placeholder are part of the .http file, e.g: "project": "${data.project}"
+//
+func escapeForJSON(value string) string {
+	escaped := bytes.Buffer{}
+	encoder := json.NewEncoder(&escaped)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(value)
+
+	quoted := strings.TrimSuffix(escaped.String(), "\n")
+	return quoted[1 : len(quoted)-1]
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func Test_resolveRequestEscaping(t *testing.T) {
+	event := newTestEvent("sh.keptn.event.problem.open.triggered", map[string]interface{}{
+		"project": "sock shop",
+		"problem": map[string]interface{}{"title": "CPU \"saturation\"\non host"},
+		"labels":  map[string]interface{}{"url": "https://example.com/api", "path": "a/b"},
+		"result":  map[string]interface{}{"score": 97.5, "passed": true, "id": 6665700014152199021},
+	})
+	placeholders, err := newHttpPlaceholders(event, []string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{
+			name:    "JSON body",
+			request: "POST https://example.com/hook\nContent-Type: application/json\n\n{\"title\": \"${data.problem.title}\"}",
+			want:    "POST https://example.com/hook\nContent-Type: application/json\n\n{\"title\": \"CPU \\\"saturation\\\"\\non host\"}",
+		},
+		{
+			name:    "JSON body without Content-Type",
+			request: "POST https://example.com/hook\n\n[\"${data.problem.title}\"]",
+			want:    "POST https://example.com/hook\n\n[\"CPU \\\"saturation\\\"\\non host\"]",
+		},
+		{
+			name:    "form body",
+			request: "POST https://example.com/hook\nContent-Type: application/x-www-form-urlencoded\n\nproject=${data.project}&path=${data.labels.path}",
+			want:    "POST https://example.com/hook\nContent-Type: application/x-www-form-urlencoded\n\nproject=sock+shop&path=a%2Fb",
+		},
+		{
+			name:    "text body",
+			request: "POST https://example.com/hook\nContent-Type: text/plain\n\n${data.project}",
+			want:    "POST https://example.com/hook\nContent-Type: text/plain\n\nsock shop",
+		},
+		{
+			name:    "request line",
+			request: "GET ${data.labels.url}/projects/${data.project}?filter=${data.labels.path} HTTP/1.1",
+			want:    "GET https://example.com/api/projects/sock%20shop?filter=a%2Fb HTTP/1.1",
+		},
+		{
+			name:    "query string over multiple lines",
+			request: "GET https://example.com/projects\n  ?project=${data.project}\n  &path=${data.labels.path}\nAccept: ${data.labels.path}",
+			want:    "GET https://example.com/projects\n  ?project=sock+shop\n  &path=a%2Fb\nAccept: a/b",
+		},
+		{
+			name:    "header",
+			request: "POST https://example.com/hook\nX-Problem: ${data.problem.title}",
+			want:    "POST https://example.com/hook\nX-Problem: CPU \"saturation\" on host",
+		},
+		{
+			name:    "raw",
+			request: "GET https://example.com/${raw:data.labels.path}\n\n{\"title\": \"${raw:data.project}\"}",
+			want:    "GET https://example.com/a/b\n\n{\"title\": \"sock shop\"}",
+		},
+		{
+			name:    "numbers and booleans",
+			request: "GET https://example.com/results/${data.result.id}?passed=${data.result.passed}\n\n{\"score\": ${data.result.score}}",
+			want:    "GET https://example.com/results/6665700014152199021?passed=true\n\n{\"score\": 97.5}",
+		},
+		{
+			name:    "JSON in body",
+			request: "POST https://example.com/hook\nContent-Type: application/json\n\n{\"labels\": ${json:data.labels}, \"title\": ${json:data.problem.title}}",
+			want:    "POST https://example.com/hook\nContent-Type: application/json\n\n{\"labels\": {\"path\":\"a/b\",\"url\":\"https://example.com/api\"}, \"title\": \"CPU \\\"saturation\\\"\\non host\"}",
+		},
+		{
+			name:    "JSON in query string",
+			request: "GET https://example.com/?result=${json:data.result}",
+			want:    "GET https://example.com/?result=%7B%22id%22%3A6665700014152199021%2C%22passed%22%3Atrue%2C%22score%22%3A97.5%7D",
+		},
+		{
+			name:    "comments and unknown placeholders",
+			request: "# @assert body $.project == ${data.project}\nGET https://example.com/${data.unknown}",
+			want:    "# @assert body $.project == sock shop\nGET https://example.com/${data.unknown}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := placeholders.resolveRequest(tt.request)
+			if err != nil {
+				t.Fatalf("resolveRequest() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("resolveRequest() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_manageKeptnPlaceholdersJSON(t *testing.T) {
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{
+		"project": "sockshop",
+		"labels":  map[string]interface{}{"owner": "team-a"},
+		"ids":     []interface{}{1, 2},
+	})
+
+	got, _ := manageKeptnPlaceholders("LABELS=${json:data.labels} IDS=${json:data.ids} PROJECT=${json:data.project} MISSING=${json:data.missing}", event, []string{})
+	want := `LABELS={"owner":"team-a"} IDS=[1,2] PROJECT="sockshop" MISSING=${json:data.missing}`
+	if got != want {
+		t.Errorf("manageKeptnPlaceholders() = %s, want %s", got, want)
+	}
+}
+
+func Test_parseHttpRequestsUnresolvedPlaceholders(t *testing.T) {
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop"})
+	content := "# ${data.documentation} isn't checked\nPOST https://example.com/${data.project}/${data.deployment.gitcommit}\n\n{\"commit\": \"${data.deployment.gitcommit}\", \"stage\": \"${data.stage}\"}"
+
+	tests := []struct {
+		name      string
+		policy    string
+		directive string
+		wantURI   string
+		wantBody  string
+		wantErr   string
+	}{
+		{name: "warn", policy: UnresolvedPlaceholdersWarn, wantURI: "https://example.com/sockshop/${data.deployment.gitcommit}", wantBody: "{\"commit\": \"${data.deployment.gitcommit}\", \"stage\": \"${data.stage}\"}\n"},
+		{name: "empty", policy: UnresolvedPlaceholdersEmpty, wantURI: "https://example.com/sockshop/", wantBody: "{\"commit\": \"\", \"stage\": \"\"}\n"},
+		{name: "error", policy: UnresolvedPlaceholdersError, wantErr: "Unresolved placeholders: ${data.deployment.gitcommit}, ${data.stage}"},
+		{name: "directive overwrites policy", policy: UnresolvedPlaceholdersWarn, directive: "# @unresolved error\n", wantErr: "Unresolved placeholders: ${data.deployment.gitcommit}, ${data.stage}"},
+		{name: "invalid directive", policy: UnresolvedPlaceholdersWarn, directive: "# @unresolved ignore\n", wantErr: "Invalid policy for unresolved placeholders ignore: must be error, warn or empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(policy string) { UnresolvedPlaceholders = policy }(UnresolvedPlaceholders)
+			UnresolvedPlaceholders = tt.policy
+
+			requests, err := parseHttpRequestsFromString(tt.directive+content, event, []string{})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("parseHttpRequestsFromString() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHttpRequestsFromString() error = %v", err)
+			}
+			if requests[0].uri != tt.wantURI || requests[0].body != tt.wantBody {
+				t.Errorf("parseHttpRequestsFromString() = %s %q, want %s %q", requests[0].uri, requests[0].body, tt.wantURI, tt.wantBody)
+			}
+		})
+	}
+}
+
+func Test_executeHttpUnresolvedPlaceholders(t *testing.T) {
+	directory, err := ioutil.TempDir("", "generic-executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	fileName := filepath.Join(directory, "test.triggered.http")
+	if err := ioutil.WriteFile(fileName, []byte("# @unresolved error\nGET https://example.com/${data.deployment.gitcommit}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop"})
+	outcome, err := executeScriptOrHTTP(context.Background(), newScriptAction("generic-executor/test.triggered.http", fileName), event, []string{})
+	if err == nil || outcome.status != keptnv2.StatusErrored {
+		t.Fatalf("executeScriptOrHTTP() = %s, %v, want errored", outcome.status, err)
+	}
+
+	properties := parseResponseProperties(outcome)
+	if !reflect.DeepEqual(properties["unresolvedPlaceholders"], []interface{}{"${data.deployment.gitcommit}"}) {
+		t.Errorf("finished event properties = %v, want the unresolved placeholders", properties)
+	}
+}
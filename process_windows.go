@@ -0,0 +1,20 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on windows as there are no unix process groups
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// killProcessGroup kills the command itself as we can't address its process group on windows
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
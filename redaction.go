@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// redactedValue replaces every secret value the service writes to logs or events
+const redactedValue = "***"
+
+// minRedactedValueLength avoids that short values like "1" or "yes" of a sensitive env variable get masked everywhere
+const minRedactedValueLength = 4
+
+// redactor knows all values that came from a secret or a sensitive env variable and masks them in any text
+type redactor struct {
+	mutex  sync.RWMutex
+	values map[string]bool
+	// values sorted by length (longest first) so that a secret containing another secret is masked as a whole
+	sortedValues []string
+}
+
+// secretRedactor is used for all logs and events of the service
+var secretRedactor = &redactor{values: map[string]bool{}}
+
+//
+// Registers values that must never show up in logs or events. Values that are too short are ignored
+//
+func (r *redactor) add(values ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	changed := false
+	for _, value := range values {
+		// a secret read from a file often ends with a new line - the value without it is just as secret
+		for _, candidate := range append([]string{value}, escapedForms(strings.TrimSpace(value))...) {
+			if len(candidate) < minRedactedValueLength || r.values[candidate] {
+				continue
+			}
+			r.values[candidate] = true
+			r.sortedValues = append(r.sortedValues, candidate)
+			changed = true
+		}
+	}
+
+	if changed {
+		sort.Slice(r.sortedValues, func(i, j int) bool { return len(r.sortedValues[i]) > len(r.sortedValues[j]) })
+	}
+}
+
+//
+// Returns a value together with the forms it takes when it is inserted into a .http file - see placeholderContext.escape - or a template
+// e.g: ab+cd/ef== also shows up as ab%2Bcd%2Fef%3D%3D in a query string
+//
+func escapedForms(value string) []string {
+	forms := []string{
+		value,
+		url.QueryEscape(value),
+		url.PathEscape(value),
+		escapeForJSON(value),
+		headerLineBreaks.Replace(value),
+	}
+	// the json function of templates also escapes <, > and &
+	if valueAsJSON, err := json.Marshal(value); err == nil {
+		forms = append(forms, string(valueAsJSON[1:len(valueAsJSON)-1]))
+	}
+	return forms
+}
+
+//
+// Returns the text with all registered values replaced by ***
+//
+func (r *redactor) redact(text string) string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, value := range r.sortedValues {
+		if strings.Contains(text, value) {
+			text = strings.Replace(text, value, redactedValue, -1)
+		}
+	}
+	return text
+}
+
+//
+// Returns a copy of a decoded JSON value (map, array, string ...) with all registered values in strings replaced by ***
+//
+func (r *redactor) redactJSONValue(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case string:
+		return r.redact(typedValue)
+	case map[string]interface{}:
+		redactedMap := map[string]interface{}{}
+		for key, item := range typedValue {
+			redactedMap[key] = r.redactJSONValue(item)
+		}
+		return redactedMap
+	case []interface{}:
+		redactedArray := make([]interface{}, len(typedValue))
+		for ix, item := range typedValue {
+			redactedArray[ix] = r.redactJSONValue(item)
+		}
+		return redactedArray
+	case map[string]string:
+		redactedMap := map[string]string{}
+		for key, item := range typedValue {
+			redactedMap[key] = r.redact(item)
+		}
+		return redactedMap
+	}
+	return value
+}
+
+//
+// Registers all values of a secret so that they are masked - even those of keys that are not used
+//
+func registerSecretValues(secret map[string]string) {
+	for _, value := range secret {
+		secretRedactor.add(value)
+	}
+}
+
+//
+// Registers the values of all env variables of the service that match EnvDenylist, e.g: DT_API_TOKEN
+//
+func registerSensitiveEnvValues() {
+	for _, env := range os.Environ() {
+		pair := strings.SplitN(env, "=", 2)
+		if len(pair) == 2 && isSensitiveEnvVariable(pair[0]) {
+			secretRedactor.add(pair[1])
+		}
+	}
+}
+
+// redactingWriter masks secret values before passing the output on, e.g: to os.Stderr for the log package
+type redactingWriter struct {
+	out io.Writer
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	// the log package writes every entry with a single call, so a value never gets split across two writes
+	if _, err := io.WriteString(w.out, secretRedactor.redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+//
+// Returns a copy of the data of an outgoing event without any secret values in its message, labels and properties
+//
+func redactEventData(data keptn.EventProperties) keptn.EventProperties {
+	switch typedData := data.(type) {
+	case *keptnv2.EventData:
+		redactedData := *typedData
+		redactedData.Message = secretRedactor.redact(typedData.Message)
+		if typedData.Labels != nil {
+			redactedData.Labels = secretRedactor.redactJSONValue(typedData.Labels).(map[string]string)
+		}
+		return &redactedData
+	case *FinishedEventPayload:
+		return &FinishedEventPayload{eventData: secretRedactor.redactJSONValue(typedData.eventData).(map[string]interface{})}
+	}
+	return data
+}
+
+//
+// Sends a task.status.changed event after removing all secret values from it
+//
+func sendTaskStatusChangedEvent(myKeptn *keptnv2.Keptn, data keptn.EventProperties) (string, error) {
+	return myKeptn.SendTaskStatusChangedEvent(redactEventData(data), ServiceName)
+}
+
+//
+// Sends a task.finished event after removing all secret values from it
+//
+func sendTaskFinishedEvent(myKeptn *keptnv2.Keptn, data keptn.EventProperties) (string, error) {
+	return myKeptn.SendTaskFinishedEvent(redactEventData(data), ServiceName)
+}
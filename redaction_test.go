@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func Test_redactorRedact(t *testing.T) {
+	r := &redactor{values: map[string]bool{}}
+	r.add("my-token\n", "abc", "my-token-with-suffix", "ab+cd/ef==", "line1-secret\nline2")
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "no secret", input: "nothing to hide", want: "nothing to hide"},
+		{name: "secret", input: "Authorization: Api-Token my-token", want: "Authorization: Api-Token ***"},
+		{name: "secret multiple times", input: "my-token my-token", want: "*** ***"},
+		{name: "longer secret first", input: "my-token-with-suffix", want: "***"},
+		{name: "too short values are not masked", input: "abc", want: "abc"},
+		{name: "query escaped secret", input: "?token=ab%2Bcd%2Fef%3D%3D&a=line1-secret%0Aline2", want: "?token=***&a=***"},
+		{name: "JSON escaped secret", input: `{"token": "line1-secret\nline2"}`, want: `{"token": "***"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.redact(tt.input); got != tt.want {
+				t.Errorf("redact() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_redactSecretsInLogsAndEvents(t *testing.T) {
+	secretRedactor.add("super-secret-value")
+	defer func() { secretRedactor = &redactor{values: map[string]bool{}} }()
+
+	var logOutput bytes.Buffer
+	log.SetOutput(&redactingWriter{out: &logOutput})
+	defer log.SetOutput(os.Stderr)
+	log.Printf("DT_API_TOKEN=%s", "super-secret-value")
+	if bytes.Contains(logOutput.Bytes(), []byte("super-secret-value")) {
+		t.Errorf("log output contains secret: %s", logOutput.String())
+	}
+
+	eventData := redactEventData(&keptnv2.EventData{Message: "curl -H 'Authorization: super-secret-value'"}).(*keptnv2.EventData)
+	if eventData.Message != "curl -H 'Authorization: ***'" {
+		t.Errorf("message not redacted: %s", eventData.Message)
+	}
+
+	payload := redactEventData(&FinishedEventPayload{eventData: map[string]interface{}{
+		"test": map[string]interface{}{"tokens": []interface{}{"super-secret-value", 5}},
+	}}).(*FinishedEventPayload)
+	tokens := payload.eventData["test"].(map[string]interface{})["tokens"].([]interface{})
+	if tokens[0] != "***" || tokens[1] != 5 {
+		t.Errorf("payload not redacted: %v", tokens)
+	}
+}
+
+func Test_redactEscapedSecretsOfHttpRequests(t *testing.T) {
+	directory, err := ioutil.TempDir("", "generic-executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	defer func() { secretRedactor = &redactor{values: map[string]bool{}} }()
+
+	os.MkdirAll(filepath.Join(directory, "secrets", "webhook"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(directory, "secrets", "webhook", "token"), []byte("ab+cd/ef=="), 0600)
+	ioutil.WriteFile(filepath.Join(directory, "secrets", "webhook", "note"), []byte("line1-secret\nline2-secret"), 0600)
+	secretProvider = &directorySecretProvider{directory: filepath.Join(directory, "secrets")}
+	defer func() { secretProvider = nil }()
+	SecretAllowlist = []string{"webhook"}
+	defer func() { SecretAllowlist = nil }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	fileName := filepath.Join(directory, "test.triggered.http")
+	// with multiple requests the URIs end up in the properties of the finished event
+	content := "POST " + server.URL + "/hook?token=${secret.webhook.token}\nContent-Type: application/json\n\n{\"note\": \"${secret.webhook.note}\"}\n###\nGET " + server.URL + "/status?token=${secret.webhook.token}\n"
+	if err := ioutil.WriteFile(fileName, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var logOutput bytes.Buffer
+	log.SetOutput(&redactingWriter{out: &logOutput})
+	defer log.SetOutput(os.Stderr)
+	defer func(verbose bool) { VerboseLogging = verbose }(VerboseLogging)
+	VerboseLogging = true
+
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop"})
+	outcome, err := executeScriptOrHTTP(context.Background(), newScriptAction("generic-executor/test.triggered.http", fileName), event, []string{})
+	if err != nil {
+		t.Fatalf("executeScriptOrHTTP() error = %v", err)
+	}
+
+	for name, text := range map[string]string{"log": logOutput.String(), "output": outcome.output, "properties": outcome.responseJSON} {
+		for _, leaked := range []string{"ab%2Bcd%2Fef%3D%3D", "line1-secret", "ab+cd"} {
+			if strings.Contains(text, leaked) {
+				t.Errorf("%s contains the secret %s: %s", name, leaked, text)
+			}
+		}
+	}
+}
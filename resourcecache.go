@@ -0,0 +1,127 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResourceCacheTTL is how long resources and negative lookups of the configuration service are cached. 0 disables the cache
+var ResourceCacheTTL time.Duration
+
+// cachedResource is the content of a resource on one level - or the information that it doesn't exist there
+type cachedResource struct {
+	content string
+	found   bool
+	expires time.Time
+}
+
+// resourceCache avoids asking the configuration service for the same resources with every event
+// Entries of a project are dropped when a configuration change of the project is received or a resource with a new version is fetched
+type resourceCache struct {
+	mutex   sync.Mutex
+	entries map[string]cachedResource
+	// versions are the last known versions (commits) of the configuration repo by project and branch
+	versions map[string]string
+}
+
+// keptnResourceCache is used by fetchKeptnResource
+var keptnResourceCache = newResourceCache()
+
+func newResourceCache() *resourceCache {
+	return &resourceCache{entries: map[string]cachedResource{}, versions: map[string]string{}}
+}
+
+//
+// Returns the key of a resource on a level. Parts that don't matter for the level are left out so that e.g: all services of a stage share the stage resources
+//
+func resourceCacheKey(project string, stage string, service string, level string, resource string) string {
+	switch level {
+	case "project":
+		stage, service = "", ""
+	case "stage":
+		service = ""
+	}
+	return strings.Join([]string{project, stage, service, level, resource}, "/")
+}
+
+//
+// Returns the cached resource for a key. The second return value is false if there is none or it expired
+//
+func (c *resourceCache) get(key string) (cachedResource, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return cachedResource{}, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return cachedResource{}, false
+	}
+	return entry, true
+}
+
+//
+// Caches the content of a resource - or with found=false that it doesn't exist - for ResourceCacheTTL
+//
+func (c *resourceCache) put(key string, content string, found bool) {
+	if ResourceCacheTTL <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[key] = cachedResource{content: content, found: found, expires: time.Now().Add(ResourceCacheTTL)}
+}
+
+//
+// Remembers the version of the configuration repo a resource was fetched from and drops all entries of the project if the version changed
+//
+func (c *resourceCache) observeVersion(project string, branch string, version string) {
+	if version == "" {
+		return
+	}
+
+	c.mutex.Lock()
+	key := project + "/" + branch
+	previousVersion, known := c.versions[key]
+	c.versions[key] = version
+	c.mutex.Unlock()
+
+	if known && previousVersion != version {
+		log.Printf("Configuration of project %s changed from version %s to %s - dropping cached resources", project, previousVersion, version)
+		c.invalidateProject(project)
+	}
+}
+
+//
+// Drops all cached resources of a project. Returns the number of dropped entries
+//
+func (c *resourceCache) invalidateProject(project string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	dropped := 0
+	for key := range c.entries {
+		if strings.HasPrefix(key, project+"/") {
+			delete(c.entries, key)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+//
+// Drops the cached resources of the project of an event if the event tells that its configuration changed, e.g: sh.keptn.event.configuration.change
+//
+func invalidateResourceCacheForEvent(eventType string, project string) {
+	if project == "" || !(strings.Contains(eventType, "configuration.change") || strings.Contains(eventType, "configuration-change")) {
+		return
+	}
+	if dropped := keptnResourceCache.invalidateProject(project); dropped > 0 {
+		log.Printf("Dropped %d cached resources of project %s because of %s", dropped, project, eventType)
+	}
+}
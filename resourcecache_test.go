@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func Test_fetchKeptnResourceCached(t *testing.T) {
+	defer func(ttl time.Duration) { ResourceCacheTTL = ttl }(ResourceCacheTTL)
+	ResourceCacheTTL = time.Minute
+	keptnResourceCache = newResourceCache()
+
+	// the configuration service only knows .sh files on project level
+	var requests int32
+	version := "commit-1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if strings.Contains(r.URL.Path, "/stage/") || !strings.HasSuffix(r.URL.Path, ".sh") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"resourceURI":     "generic-executor/test.triggered.sh",
+			"resourceContent": base64.StdEncoding.EncodeToString([]byte("echo test")),
+			"metadata":        map[string]string{"branch": "master", "version": version},
+		})
+	}))
+	defer server.Close()
+
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop", "stage": "dev", "service": "carts"})
+	myKeptn, err := keptnv2.NewKeptn(&event, keptn.KeptnOpts{ConfigurationServiceURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lookup := func() {
+		for _, level := range resourceLevels {
+			content, err := fetchKeptnResource(myKeptn, "generic-executor/test.triggered.sh", level)
+			if wantFound := level == "project"; (err == nil) != wantFound || (wantFound && content != "echo test") {
+				t.Fatalf("fetchKeptnResource(%s) = %s, %v", level, content, err)
+			}
+		}
+	}
+
+	lookup()
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Fatalf("first lookup sent %d requests, want 3", got)
+	}
+
+	// found and not found are both served from the cache
+	lookup()
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Fatalf("cached lookup sent %d requests, want 3", got)
+	}
+
+	// a configuration change drops the cached resources of the project
+	invalidateResourceCacheForEvent("sh.keptn.event.configuration.change", "sockshop")
+	lookup()
+	if got := atomic.LoadInt32(&requests); got != 6 {
+		t.Fatalf("lookup after configuration change sent %d requests, want 6", got)
+	}
+
+	// so does a resource with a new version of the configuration repo
+	version = "commit-2"
+	if _, err := fetchKeptnResource(myKeptn, "generic-executor/all.events.sh", "project"); err != nil {
+		t.Fatal(err)
+	}
+	lookup()
+	if got := atomic.LoadInt32(&requests); got != 10 {
+		t.Fatalf("lookup after version change sent %d requests, want 10", got)
+	}
+}
+
+func Test_resourceCache(t *testing.T) {
+	defer func(ttl time.Duration) { ResourceCacheTTL = ttl }(ResourceCacheTTL)
+
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		wait      time.Duration
+		wantFound bool
+	}{
+		{name: "cached", ttl: time.Minute, wantFound: true},
+		{name: "expired", ttl: 10 * time.Millisecond, wait: 20 * time.Millisecond},
+		{name: "disabled", ttl: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ResourceCacheTTL = tt.ttl
+			cache := newResourceCache()
+			key := resourceCacheKey("sockshop", "dev", "carts", "stage", "generic-executor/all.events.sh")
+			if key != resourceCacheKey("sockshop", "dev", "orders", "stage", "generic-executor/all.events.sh") {
+				t.Errorf("services of a stage don't share stage resources")
+			}
+
+			cache.put(key, "echo test", true)
+			time.Sleep(tt.wait)
+			if _, found := cache.get(key); found != tt.wantFound {
+				t.Errorf("get() found = %t, want %t", found, tt.wantFound)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/keptn/go-utils/pkg/api/models"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+//
+// Stores all files of generic-executor/ from project, stage and service level as uniquePrefix/generic-executor/ so that scripts can use files next to them, e.g: source ./lib.sh
+// Files on service level win over those on stage level which win over those on project level. Returns the absolute path of the directory
+// On the local filesystem generic-executor/ is copied as it is
+//
+func materializeScriptDirectory(myKeptn *keptnv2.Keptn, uniquePrefix string) (string, error) {
+	if myKeptn.UseLocalFileSystem {
+		return copyDirectory(GenericScriptFolderBase, filepath.Join(uniquePrefix, GenericScriptFolderBase))
+	}
+
+	// project first so that stage and service level overwrite its files
+	files := map[string]string{}
+	for ix := len(resourceLevels) - 1; ix >= 0; ix-- {
+		level := resourceLevels[ix]
+		resources, err := listKeptnResources(myKeptn, level)
+		if err != nil {
+			// scripts that don't need other files still work
+			log.Printf("Failed to list resources on %s level: %s", level, err.Error())
+			continue
+		}
+		for _, resource := range resources {
+			if strings.HasPrefix(resource, GenericScriptFolderBase) {
+				files[resource] = level
+			}
+		}
+	}
+
+	for resource, level := range files {
+		content, err := fetchKeptnResource(myKeptn, resource, level)
+		if err != nil {
+			log.Printf("Failed to get %s from %s level: %s", resource, level, err.Error())
+			continue
+		}
+		if _, err := storeKeptnResource(fmt.Sprintf("%s/%s", uniquePrefix, resource), content); err != nil {
+			return "", err
+		}
+	}
+
+	return filepath.Abs(filepath.Join(uniquePrefix, GenericScriptFolderBase))
+}
+
+//
+// Copies all files of source to target and returns the absolute path of target
+//
+func copyDirectory(source string, target string) (string, error) {
+	err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(target, relativePath), os.ModePerm)
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(target, relativePath), content, info.Mode())
+	})
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(target)
+}
+
+//
+// Returns the URIs of all resources on service, stage or project level, e.g: generic-executor/lib.sh
+// The list is cached like the resources themselves - see resourceCache
+//
+func listKeptnResources(myKeptn *keptnv2.Keptn, level string) ([]string, error) {
+	project, stage, service := myKeptn.Event.GetProject(), myKeptn.Event.GetStage(), myKeptn.Event.GetService()
+
+	// resource URIs never end with a slash - so this key can't collide with the one of a resource
+	cacheKey := resourceCacheKey(project, stage, service, level, GenericScriptFolderBase)
+	if cached, ok := keptnResourceCache.get(cacheKey); ok {
+		observeResourceCacheLookup(true)
+		if cached.content == "" {
+			return []string{}, nil
+		}
+		return strings.Split(cached.content, "\n"), nil
+	}
+	observeResourceCacheLookup(false)
+
+	var resources []*models.Resource
+	var err error
+	switch level {
+	case "service":
+		resources, err = myKeptn.ResourceHandler.GetAllServiceResources(project, stage, service)
+	case "stage":
+		resources, err = myKeptn.ResourceHandler.GetAllStageResources(project, stage)
+	case "project":
+		resources, err = getAllProjectResources(myKeptn, project)
+	default:
+		return nil, fmt.Errorf("Unknown level %s", level)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	uris := []string{}
+	for _, resource := range resources {
+		if resource != nil && resource.ResourceURI != nil {
+			uris = append(uris, strings.TrimPrefix(*resource.ResourceURI, "/"))
+		}
+	}
+	keptnResourceCache.put(cacheKey, strings.Join(uris, "\n"), true)
+	return uris, nil
+}
+
+//
+// Returns all resources on project level. Unlike for stage and service the ResourceHandler doesn't offer this
+//
+func getAllProjectResources(myKeptn *keptnv2.Keptn, project string) ([]*models.Resource, error) {
+	resourceHandler := myKeptn.ResourceHandler
+
+	resources := []*models.Resource{}
+	nextPageKey := ""
+	for {
+		query := url.Values{}
+		if nextPageKey != "" {
+			query.Set("nextPageKey", nextPageKey)
+		}
+		request, err := http.NewRequest("GET", resourceHandler.Scheme+"://"+resourceHandler.BaseURL+"/v1/project/"+url.PathEscape(project)+"/resource?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		if resourceHandler.AuthHeader != "" && resourceHandler.AuthToken != "" {
+			request.Header.Set(resourceHandler.AuthHeader, resourceHandler.AuthToken)
+		}
+
+		response, err := resourceHandler.HTTPClient.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Listing resources of project %s returned status code %d: %s", project, response.StatusCode, string(body))
+		}
+
+		page := models.Resources{}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		resources = append(resources, page.Resources...)
+
+		if page.NextPageKey == "" || page.NextPageKey == "0" {
+			return resources, nil
+		}
+		nextPageKey = page.NextPageKey
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func Test_materializeScriptDirectory(t *testing.T) {
+	keptnResourceCache = newResourceCache()
+
+	// the content of every resource tells from which level it was taken
+	resourcesByLevel := map[string][]string{
+		"service": {"generic-executor/lib.sh", "generic-executor/test.triggered.sh"},
+		"stage":   {"generic-executor/lib.sh", "generic-executor/data/users.csv"},
+		"project": {"/generic-executor/lib.sh", "/generic-executor/data/users.csv", "/generic-executor/helpers/common.py", "/helm/carts.tgz"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		level := "project"
+		if strings.Contains(r.URL.Path, "/service/") {
+			level = "service"
+		} else if strings.Contains(r.URL.Path, "/stage/") {
+			level = "stage"
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/resource") || strings.HasSuffix(r.URL.Path, "/resource/") {
+			resources := []map[string]string{}
+			for _, uri := range resourcesByLevel[level] {
+				resources = append(resources, map[string]string{"resourceURI": uri})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"resources": resources})
+			return
+		}
+
+		uri := r.URL.Path[strings.Index(r.URL.Path, "/resource/")+len("/resource/"):]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"resourceURI":     uri,
+			"resourceContent": base64.StdEncoding.EncodeToString([]byte(level)),
+		})
+	}))
+	defer server.Close()
+
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop", "stage": "dev", "service": "carts"})
+	myKeptn, err := keptnv2.NewKeptn(&event, keptn.KeptnOpts{ConfigurationServiceURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uniquePrefix, err := ioutil.TempDir("", "generic-executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(uniquePrefix)
+
+	directory, err := materializeScriptDirectory(myKeptn, uniquePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"lib.sh":            "service",
+		"test.triggered.sh": "service",
+		"data/users.csv":    "stage",
+		"helpers/common.py": "project",
+	}
+	got := map[string]string{}
+	filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			content, _ := ioutil.ReadFile(path)
+			relativePath, _ := filepath.Rel(directory, path)
+			got[filepath.ToSlash(relativePath)] = string(content)
+		}
+		return nil
+	})
+	if len(got) != len(want) {
+		t.Errorf("materializeScriptDirectory() stored %v, want %v", got, want)
+	}
+	for file, level := range want {
+		if got[file] != level {
+			t.Errorf("%s is from %s level, want %s", file, got[file], level)
+		}
+	}
+}
+
+func Test_executeScriptInScriptDirectory(t *testing.T) {
+	directory, err := ioutil.TempDir("", "generic-executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	files := map[string]string{
+		"lib.sh":            "greet() { echo \"hello from lib\"; }\n",
+		"test.triggered.sh": "source ./lib.sh\ngreet\necho '{\"sourced\": true}' > \"$ID.finished.event.json\"\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(directory, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop"})
+	action := newScriptAction("generic-executor/test.triggered.sh", filepath.Join(directory, "test.triggered.sh"))
+	action.directory = directory
+
+	outcome, err := executeScriptOrHTTP(context.Background(), action, event, []string{"PATH=" + os.Getenv("PATH")})
+	output, finishedJSON, result := outcome.output, outcome.responseJSON, outcome.result
+	if err != nil {
+		t.Fatalf("executeScriptOrHTTP() error = %v, output = %s", err, output)
+	}
+	if result != keptnv2.ResultPass || !strings.Contains(output, "hello from lib") {
+		t.Errorf("executeScriptOrHTTP() = %s, %s", result, output)
+	}
+	if strings.TrimSpace(finishedJSON) != `{"sourced": true}` {
+		t.Errorf("finished event JSON = %s - it must be read from the directory of the script", finishedJSON)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScriptOutputLimit is how many bytes of stdout and of stderr of a script are kept for the finished event (0 = no limit)
+// Longer output keeps its beginning and its end
+var ScriptOutputLimit = 32 * 1024
+
+// commandResult is what a command printed and how it ended as it is reported in the finished event
+type commandResult struct {
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+	// ExitCode is -1 if the command was killed, e.g: because of a timeout
+	ExitCode int    `json:"exitCode"`
+	Duration string `json:"duration"`
+}
+
+// cappedBuffer keeps the first and the last bytes written to it if more than limit bytes are written
+type cappedBuffer struct {
+	mutex sync.Mutex
+	limit int
+	head  []byte
+	tail  []byte
+	total int
+}
+
+func newCappedBuffer(limit int) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	written := len(p)
+	b.total += written
+	if b.limit <= 0 {
+		b.head = append(b.head, p...)
+		return written, nil
+	}
+
+	// the first half of the limit goes to head, everything after that to tail of which we only keep the end
+	headLimit := b.limit / 2
+	if missing := headLimit - len(b.head); missing > 0 {
+		if missing > len(p) {
+			missing = len(p)
+		}
+		b.head = append(b.head, p[:missing]...)
+		p = p[missing:]
+	}
+
+	tailLimit := b.limit - headLimit
+	b.tail = append(b.tail, p...)
+	if len(b.tail) > tailLimit {
+		b.tail = append([]byte{}, b.tail[len(b.tail)-tailLimit:]...)
+	}
+	return written, nil
+}
+
+//
+// Returns everything that was written - or its beginning and end with a note how many bytes were left out
+//
+func (b *cappedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	truncated := b.total - len(b.head) - len(b.tail)
+	if truncated <= 0 {
+		return string(b.head) + string(b.tail)
+	}
+	return fmt.Sprintf("%s\n... %d bytes truncated ...\n%s", string(b.head), truncated, string(b.tail))
+}
+
+//
+// Returns a writer that logs every line of a stream of a command as soon as it was written, e.g: test.triggered.sh [stderr] connection refused
+//
+func newOutputLogger(label string, stream string) *lineWriter {
+	return &lineWriter{onLine: func(line string) {
+		log.Printf("%s [%s] %s", label, stream, line)
+	}}
+}
+
+//
+// Returns a short name for a command in logs: the file name of the script it executes if there is one
+//
+func commandLabel(command string, args []string) string {
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return filepath.Base(arg)
+		}
+	}
+	return filepath.Base(command)
+}
+
+//
+// Formats the duration of a command rounded to milliseconds, e.g: 1.234s
+//
+func formatCommandDuration(duration time.Duration) string {
+	return duration.Round(time.Millisecond).String()
+}
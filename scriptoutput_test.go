@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_cappedBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		writes []string
+		want   string
+	}{
+		{name: "below limit", limit: 10, writes: []string{"abc", "def"}, want: "abcdef"},
+		{name: "exactly at limit", limit: 6, writes: []string{"abc", "def"}, want: "abcdef"},
+		{name: "keeps beginning and end", limit: 6, writes: []string{"abcdefgh", "ijkl"}, want: "abc\n... 6 bytes truncated ...\njkl"},
+		{name: "many small writes", limit: 4, writes: []string{"a", "b", "c", "d", "e", "f"}, want: "ab\n... 2 bytes truncated ...\nef"},
+		{name: "no limit", limit: 0, writes: []string{"abcdefgh", "ijkl"}, want: "abcdefghijkl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := newCappedBuffer(tt.limit)
+			for _, write := range tt.writes {
+				if n, err := buffer.Write([]byte(write)); n != len(write) || err != nil {
+					t.Fatalf("Write() = %d, %v", n, err)
+				}
+			}
+			if got := buffer.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_executeCommandOutput(t *testing.T) {
+	defer func(limit int) { ScriptOutputLimit = limit }(ScriptOutputLimit)
+	ScriptOutputLimit = 64
+
+	script := fmt.Sprintf("echo out; echo err >&2; printf '%s'; exit 3", strings.Repeat("x", 100))
+	output, err := executeCommand(context.Background(), "bash", []string{"-c", script}, []string{}, nil, 0, nil)
+
+	if err == nil || !strings.Contains(err.Error(), "err") {
+		t.Errorf("executeCommand() error = %v, want it to contain stderr", err)
+	}
+	if output.ExitCode != 3 {
+		t.Errorf("executeCommand() exit code = %d, want 3", output.ExitCode)
+	}
+	if output.Stderr != "err\n" {
+		t.Errorf("executeCommand() stderr = %q, want %q", output.Stderr, "err\n")
+	}
+	if !strings.HasPrefix(output.Stdout, "out\n") || !strings.Contains(output.Stdout, "... 40 bytes truncated ...") {
+		t.Errorf("executeCommand() stdout = %q, want its beginning and end", output.Stdout)
+	}
+	if output.Duration == "" {
+		t.Errorf("executeCommand() duration is empty")
+	}
+}
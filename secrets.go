@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// SecretProvider returns the key/value pairs of a secret, e.g: the k8s secret "dynatrace" with the key DT_API_TOKEN
+type SecretProvider interface {
+	GetSecret(name string) (map[string]string, error)
+}
+
+// secretProvider is used to resolve ${secret.name.key} placeholders and # @secret directives. nil means secrets are not available
+var secretProvider SecretProvider
+
+// SecretAllowlist are patterns of the secrets that can be referenced, e.g: dynatrace, sockshop:slack-*, sockshop/production:pagerduty
+// Entries prefixed with project: or project/stage: only apply to events of that project or stage. Every other secret is rejected
+var SecretAllowlist []string
+
+// invalidEnvVariableCharacters are replaced with _ when a secret is passed as env variable
+var invalidEnvVariableCharacters = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// serviceAccountDirectory is where k8s mounts the token, CA and namespace of the service account
+const serviceAccountDirectory = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+//
+// Creates the SecretProvider for the given type: kubernetes, directory or none
+//
+func newSecretProvider(providerType string, namespace string, directory string) (SecretProvider, error) {
+	switch strings.ToLower(providerType) {
+	case "kubernetes":
+		provider, err := newKubernetesSecretProvider(namespace)
+		if err != nil {
+			// make sure we don't return a typed nil
+			return nil, err
+		}
+		return provider, nil
+	case "directory":
+		return &directorySecretProvider{directory: directory}, nil
+	case "none", "":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Unknown secret provider %s - must be kubernetes, directory or none", providerType)
+}
+
+// kubernetesSecretProvider reads secrets from the k8s API using the service account of the pod
+type kubernetesSecretProvider struct {
+	apiURL    string
+	namespace string
+	token     string
+	client    *http.Client
+}
+
+//
+// Creates a kubernetesSecretProvider for the namespace the service is running in
+//
+func newKubernetesSecretProvider(namespace string) (*kubernetesSecretProvider, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("Not running in a k8s cluster: KUBERNETES_SERVICE_HOST or KUBERNETES_SERVICE_PORT not set")
+	}
+
+	token, err := ioutil.ReadFile(filepath.Join(serviceAccountDirectory, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read service account token: %s", err.Error())
+	}
+
+	if namespace == "" {
+		namespaceFromFile, err := ioutil.ReadFile(filepath.Join(serviceAccountDirectory, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read namespace of service account: %s", err.Error())
+		}
+		namespace = strings.TrimSpace(string(namespaceFromFile))
+	}
+
+	caCert, err := ioutil.ReadFile(filepath.Join(serviceAccountDirectory, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read CA of service account: %s", err.Error())
+	}
+	caCertPool := x509.NewCertPool()
+	caCertPool.AppendCertsFromPEM(caCert)
+
+	return &kubernetesSecretProvider{
+		apiURL:    "https://" + host + ":" + port,
+		namespace: namespace,
+		token:     strings.TrimSpace(string(token)),
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: caCertPool}},
+		},
+	}, nil
+}
+
+func (p *kubernetesSecretProvider) GetSecret(name string) (map[string]string, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/namespaces/%s/secrets/%s", p.apiURL, p.namespace, name), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to get secret %s: k8s API returned status code %d", name, resp.StatusCode)
+	}
+
+	secret := struct {
+		Data map[string]string `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return nil, err
+	}
+
+	// the values of a k8s secret are base64 encoded
+	values := map[string]string{}
+	for key, encodedValue := range secret.Data {
+		value, err := base64.StdEncoding.DecodeString(encodedValue)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode key %s of secret %s: %s", key, name, err.Error())
+		}
+		values[key] = string(value)
+	}
+	return values, nil
+}
+
+// directorySecretProvider reads secrets from a directory with one subdirectory per secret and one file per key
+// This is the layout of secrets mounted as volumes, e.g: /etc/secrets/dynatrace/DT_API_TOKEN
+type directorySecretProvider struct {
+	directory string
+}
+
+func (p *directorySecretProvider) GetSecret(name string) (map[string]string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("Invalid secret name %s", name)
+	}
+
+	secretDirectory := filepath.Join(p.directory, name)
+	files, err := ioutil.ReadDir(secretDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get secret %s: %s", name, err.Error())
+	}
+
+	values := map[string]string{}
+	for _, file := range files {
+		// skip the ..data folders and symlinks k8s creates for mounted secrets
+		if file.IsDir() || strings.HasPrefix(file.Name(), "..") {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(secretDirectory, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		values[file.Name()] = string(content)
+	}
+	return values, nil
+}
+
+// secretScope is the project and stage of an event. It decides which secrets the scripts and .http files handling the event can reference
+type secretScope struct {
+	project string
+	stage   string
+}
+
+func newSecretScope(incomingEvent cloudevents.Event) secretScope {
+	eventData := keptnv2.EventData{}
+	if err := incomingEvent.DataAs(&eventData); err != nil {
+		// without project and stage only the secrets allowed for all projects can be referenced
+		log.Printf("Failed to decode project and stage of event %s: %s", incomingEvent.ID(), err.Error())
+	}
+	return secretScope{project: eventData.Project, stage: eventData.Stage}
+}
+
+//
+// Returns an error unless the secret matches an entry of SecretAllowlist that applies to the project and stage
+// Otherwise any project could read every secret in the namespace, e.g: the Keptn API token, and send it wherever it wants
+//
+func (s secretScope) allows(name string) error {
+	for _, entry := range SecretAllowlist {
+		pattern := strings.TrimSpace(entry)
+		if ix := strings.LastIndex(pattern, ":"); ix >= 0 {
+			scope := pattern[:ix]
+			if scope != s.project && scope != s.project+"/"+s.stage {
+				continue
+			}
+			pattern = pattern[ix+1:]
+		}
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return nil
+		}
+	}
+	return fmt.Errorf("Secret %s is not allowed for project %s and stage %s - it must be listed in SECRET_ALLOWLIST", name, s.project, s.stage)
+}
+
+//
+// Returns the secret if it is allowed for the scope
+//
+func (s secretScope) getSecret(name string) (map[string]string, error) {
+	if err := s.allows(name); err != nil {
+		return nil, err
+	}
+	return secretProvider.GetSecret(name)
+}
+
+// secretValues are the secrets loaded for one file so that every secret is only fetched once
+type secretValues struct {
+	scope  secretScope
+	loaded map[string]map[string]string
+}
+
+func newSecretValues(scope secretScope) *secretValues {
+	return &secretValues{scope: scope, loaded: map[string]map[string]string{}}
+}
+
+//
+// Returns the value of a key of a secret. Returns an error if the secret or key doesn't exist or the secret isn't allowed
+// Values are registered for redaction before they are returned
+//
+func (s *secretValues) get(name string, key string) (string, error) {
+	if secretProvider == nil {
+		return "", errors.New("Secrets are referenced but no secret provider is configured")
+	}
+	if _, loaded := s.loaded[name]; !loaded {
+		secret, err := s.scope.getSecret(name)
+		if err != nil {
+			return "", err
+		}
+		registerSecretValues(secret)
+		s.loaded[name] = secret
+	}
+
+	value, exists := s.loaded[name][key]
+	if !exists {
+		return "", fmt.Errorf("Secret %s doesn't contain key %s", name, key)
+	}
+	return value, nil
+}
+
+//
+// Returns the env variables for all secrets a script requests via # @secret name, e.g: SECRET_DYNATRACE_DT_API_TOKEN=...
+//
+func getSecretEnvVariables(secretNames []string, scope secretScope) ([]string, error) {
+	envVariables := []string{}
+	if len(secretNames) == 0 {
+		return envVariables, nil
+	}
+	if secretProvider == nil {
+		return nil, errors.New("Secrets are requested but no secret provider is configured")
+	}
+
+	for _, name := range secretNames {
+		secret, err := scope.getSecret(name)
+		if err != nil {
+			return nil, err
+		}
+		registerSecretValues(secret)
+
+		// sort the keys so that scripts always see the same order
+		keys := []string{}
+		for key := range secret {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			envName := strings.ToUpper(invalidEnvVariableCharacters.ReplaceAllString("SECRET_"+name+"_"+key, "_"))
+			envVariables = append(envVariables, envName+"="+secret[key])
+		}
+	}
+	return envVariables, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestSecretDirectory(t *testing.T) string {
+	directory, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(directory, "dynatrace"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(directory, "dynatrace", "DT_API_TOKEN"), []byte("my-token"), 0600)
+	ioutil.WriteFile(filepath.Join(directory, "dynatrace", "tls.crt"), []byte("my-cert"), 0600)
+	return directory
+}
+
+func Test_secretPlaceholders(t *testing.T) {
+	directory := newTestSecretDirectory(t)
+	defer os.RemoveAll(directory)
+
+	secretProvider = &directorySecretProvider{directory: directory}
+	defer func() { secretProvider = nil }()
+	SecretAllowlist = []string{"dynatrace", "github", "/etc"}
+	defer func() { SecretAllowlist = nil }()
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "no secrets", input: "Authorization: ${env.token}", want: "Authorization: ${env.token}"},
+		{name: "secret key", input: "Authorization: Api-Token ${secret.dynatrace.DT_API_TOKEN}", want: "Authorization: Api-Token my-token"},
+		{name: "key with dot", input: "${secret.dynatrace.tls.crt}", want: "my-cert"},
+		{name: "missing key", input: "${secret.dynatrace.nothing}", wantErr: true},
+		{name: "missing secret", input: "${secret.github.token}", wantErr: true},
+		{name: "path in secret name", input: "${secret./etc.passwd}", wantErr: true},
+		{name: "secret not allowed", input: "${secret.keptn-api-token.keptn-api-token}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			placeholders := &httpPlaceholders{values: map[string]string{}, secrets: newSecretValues(secretScope{project: "sockshop", stage: "dev"})}
+			got, err := placeholders.replace(tt.input, contextVerbatim)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("replace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("replace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getSecretEnvVariables(t *testing.T) {
+	directory := newTestSecretDirectory(t)
+	defer os.RemoveAll(directory)
+
+	secretProvider = &directorySecretProvider{directory: directory}
+	defer func() { secretProvider = nil }()
+	SecretAllowlist = []string{"sockshop:dynatrace"}
+	defer func() { SecretAllowlist = nil }()
+
+	got, err := getSecretEnvVariables([]string{"dynatrace"}, secretScope{project: "sockshop", stage: "dev"})
+	if err != nil {
+		t.Fatalf("getSecretEnvVariables() error = %v", err)
+	}
+	want := []string{"SECRET_DYNATRACE_DT_API_TOKEN=my-token", "SECRET_DYNATRACE_TLS_CRT=my-cert"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("getSecretEnvVariables() = %v, want %v", got, want)
+	}
+
+	if _, err := getSecretEnvVariables([]string{"dynatrace"}, secretScope{project: "carts", stage: "dev"}); err == nil {
+		t.Errorf("getSecretEnvVariables() expected an error for a secret that isn't allowed for the project")
+	}
+}
+
+func Test_secretScopeAllows(t *testing.T) {
+	SecretAllowlist = []string{"dynatrace", "sockshop:slack-*", "sockshop/production:pagerduty"}
+	defer func() { SecretAllowlist = nil }()
+
+	tests := []struct {
+		name    string
+		scope   secretScope
+		secret  string
+		allowed bool
+	}{
+		{name: "allowed for all projects", scope: secretScope{project: "carts", stage: "dev"}, secret: "dynatrace", allowed: true},
+		{name: "allowed for project", scope: secretScope{project: "sockshop", stage: "dev"}, secret: "slack-webhook", allowed: true},
+		{name: "allowed for other project", scope: secretScope{project: "carts", stage: "dev"}, secret: "slack-webhook", allowed: false},
+		{name: "allowed for stage", scope: secretScope{project: "sockshop", stage: "production"}, secret: "pagerduty", allowed: true},
+		{name: "allowed for other stage", scope: secretScope{project: "sockshop", stage: "dev"}, secret: "pagerduty", allowed: false},
+		{name: "not listed", scope: secretScope{project: "sockshop", stage: "production"}, secret: "keptn-api-token", allowed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.scope.allows(tt.secret); (err == nil) != tt.allowed {
+				t.Errorf("allows() error = %v, want allowed %v", err, tt.allowed)
+			}
+		})
+	}
+}
+
+func Test_kubernetesSecretProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/keptn/secrets/dynatrace" || r.Header.Get("Authorization") != "Bearer my-sa-token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// "bXktdG9rZW4=" is "my-token"
+		w.Write([]byte(`{"kind": "Secret", "data": {"DT_API_TOKEN": "bXktdG9rZW4="}}`))
+	}))
+	defer server.Close()
+
+	provider := &kubernetesSecretProvider{apiURL: server.URL, namespace: "keptn", token: "my-sa-token", client: server.Client()}
+
+	secret, err := provider.GetSecret("dynatrace")
+	if err != nil {
+		t.Fatalf("GetSecret() error = %v", err)
+	}
+	if secret["DT_API_TOKEN"] != "my-token" {
+		t.Errorf("GetSecret() = %v, want DT_API_TOKEN=my-token", secret)
+	}
+
+	if _, err := provider.GetSecret("unknown"); err == nil {
+		t.Errorf("GetSecret() expected an error for an unknown secret")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statusMarker starts a line of script output that is sent to Keptn as status.changed event, e.g: ::keptn-status:: Scaled 2 of 5 pods
+const statusMarker = "::keptn-status::"
+
+// maxStatusUpdates limits the status.changed events of one script so that a script can't flood Keptn
+const maxStatusUpdates = 100
+
+// statusFilePollInterval is how often KEPTN_STATUS_FILE is checked for new lines
+var statusFilePollInterval = time.Second
+
+// statusReporter turns the progress a script reports into status.changed events - see statusMarker and KEPTN_STATUS_FILE
+type statusReporter struct {
+	mutex  sync.Mutex
+	report func(message string)
+	sent   int
+	last   string
+	closed bool
+}
+
+func newStatusReporter(report func(message string)) *statusReporter {
+	return &statusReporter{report: report}
+}
+
+//
+// Reports a message unless it is empty, the same as the last one or the script already reported maxStatusUpdates messages
+//
+func (r *statusReporter) send(message string) {
+	message = strings.TrimSpace(message)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed || message == "" || message == r.last {
+		return
+	}
+	if r.sent == maxStatusUpdates {
+		log.Printf("Ignoring further status updates after %d", maxStatusUpdates)
+		r.sent++
+	}
+	if r.sent > maxStatusUpdates {
+		return
+	}
+	r.sent++
+	r.last = message
+	r.report(message)
+}
+
+//
+// Stops sending status updates, e.g: once the script is done and the finished event is about to be sent
+//
+func (r *statusReporter) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.closed = true
+}
+
+// maxLineLength limits how much of a line a lineWriter keeps until the line ends, e.g: a script writing megabytes without a new line
+const maxLineLength = 64 * 1024
+
+// lineWriter calls onLine for every complete line written to it. Lines longer than maxLineLength are passed on truncated
+type lineWriter struct {
+	mutex   sync.Mutex
+	onLine  func(line string)
+	partial string
+	// truncated is true once the current line was passed on truncated - the rest of it is dropped until the next new line
+	truncated bool
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	lines := strings.Split(string(p), "\n")
+	for ix, line := range lines {
+		w.append(line)
+		if ix == len(lines)-1 {
+			// the line isn't complete yet
+			break
+		}
+		if !w.truncated {
+			w.onLine(strings.TrimSuffix(w.partial, "\r"))
+		}
+		w.partial = ""
+		w.truncated = false
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) append(text string) {
+	if w.truncated {
+		return
+	}
+	if len(w.partial)+len(text) <= maxLineLength {
+		w.partial += text
+		return
+	}
+	w.onLine(w.partial + text[:maxLineLength-len(w.partial)] + " ... (line truncated)")
+	w.partial = ""
+	w.truncated = true
+}
+
+//
+// Passes the last line on even if it doesn't end with a new line
+//
+func (w *lineWriter) flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.partial != "" {
+		w.onLine(w.partial)
+		w.partial = ""
+	}
+	w.truncated = false
+}
+
+//
+// Returns a writer for the output of a script that reports every line starting with statusMarker
+//
+func newStatusMarkerWriter(reporter *statusReporter) *lineWriter {
+	return &lineWriter{onLine: func(line string) {
+		if trimmedLine := strings.TrimSpace(line); strings.HasPrefix(trimmedLine, statusMarker) {
+			reporter.send(strings.TrimPrefix(trimmedLine, statusMarker))
+		}
+	}}
+}
+
+//
+// Reports every line a script appends to fileName while it runs. The returned function stops watching after reporting the remaining lines
+//
+func watchStatusFile(fileName string, reporter *statusReporter) func() {
+	lines := &lineWriter{onLine: reporter.send}
+	offset := int64(0)
+	readNewLines := func() {
+		file, err := os.Open(fileName)
+		if err != nil {
+			// the script didn't write anything yet
+			return
+		}
+		defer file.Close()
+
+		if _, err := file.Seek(offset, 0); err != nil {
+			return
+		}
+		content, _ := ioutil.ReadAll(file)
+		offset += int64(len(content))
+		lines.Write(content)
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(statusFilePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				readNewLines()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+		readNewLines()
+		lines.flush()
+	}
+}
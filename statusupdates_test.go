@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_executeScriptReportsStatus(t *testing.T) {
+	defer func(interval time.Duration) { statusFilePollInterval = interval }(statusFilePollInterval)
+	statusFilePollInterval = 10 * time.Millisecond
+
+	directory, err := ioutil.TempDir("", "generic-executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	script := `echo "::keptn-status:: Scaling up"
+echo "regular output"
+echo "Scaled 1 of 2 pods" >> "$KEPTN_STATUS_FILE"
+echo "Scaled 1 of 2 pods" >> "$KEPTN_STATUS_FILE"
+sleep 0.1
+echo "Scaled 2 of 2 pods" >> "$KEPTN_STATUS_FILE"
+printf "  ::keptn-status:: Done"
+`
+	if err := ioutil.WriteFile(filepath.Join(directory, "action.triggered.scale.sh"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mutex sync.Mutex
+	got := []string{}
+	action := newScriptAction("generic-executor/action.triggered.scale.sh", filepath.Join(directory, "action.triggered.scale.sh"))
+	action.directory = directory
+	action.reportStatus = func(message string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		got = append(got, message)
+	}
+
+	event := newTestEvent("sh.keptn.event.action.triggered", map[string]interface{}{"project": "sockshop"})
+	outcome, err := executeScriptOrHTTP(context.Background(), action, event, []string{"PATH=" + os.Getenv("PATH")})
+	if err != nil {
+		t.Fatalf("executeScriptOrHTTP() error = %v, output = %s", err, outcome.output)
+	}
+
+	// marker lines and lines of the status file arrive independently - but the same status is never reported twice in a row
+	mutex.Lock()
+	defer mutex.Unlock()
+	want := map[string]bool{"Scaling up": true, "Scaled 1 of 2 pods": true, "Scaled 2 of 2 pods": true, "Done": true}
+	if len(got) != len(want) {
+		t.Fatalf("reported %v, want %v", got, want)
+	}
+	for _, message := range got {
+		if !want[message] {
+			t.Errorf("reported unexpected status %q", message)
+		}
+	}
+}
+
+func Test_executeScriptsUseOwnStatusFile(t *testing.T) {
+	defer func(interval time.Duration) { statusFilePollInterval = interval }(statusFilePollInterval)
+	statusFilePollInterval = 10 * time.Millisecond
+
+	directory, err := ioutil.TempDir("", "generic-executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	// with EXECUTION_MODE=all both scripts run in the same directory - b.sh reports no status
+	tests := []struct {
+		script string
+		want   []string
+	}{
+		{script: "a.sh", want: []string{"Step 1 of a"}},
+		{script: "b.sh", want: []string{}},
+	}
+	scripts := map[string]string{
+		"a.sh": "echo \"Step 1 of a\" >> \"$KEPTN_STATUS_FILE\"\n",
+		"b.sh": "echo done\n",
+	}
+	event := newTestEvent("sh.keptn.event.action.triggered", map[string]interface{}{"project": "sockshop"})
+	for _, tt := range tests {
+		fileName := filepath.Join(directory, tt.script)
+		if err := ioutil.WriteFile(fileName, []byte(scripts[tt.script]), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		got := []string{}
+		action := newScriptAction("generic-executor/"+tt.script, fileName)
+		action.directory = directory
+		action.reportStatus = func(message string) { got = append(got, message) }
+
+		if _, err := executeScriptOrHTTP(context.Background(), action, event, []string{"PATH=" + os.Getenv("PATH")}); err != nil {
+			t.Fatalf("executeScriptOrHTTP(%s) error = %v", tt.script, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("executeScriptOrHTTP(%s) reported %v, want %v", tt.script, got, tt.want)
+		}
+	}
+
+	if statusFiles, _ := filepath.Glob(filepath.Join(directory, "*.status")); len(statusFiles) > 0 {
+		t.Errorf("status files %v were left behind", statusFiles)
+	}
+}
+
+func Test_statusReporter(t *testing.T) {
+	got := []string{}
+	reporter := newStatusReporter(func(message string) { got = append(got, message) })
+
+	writer := newStatusMarkerWriter(reporter)
+	fmt.Fprint(writer, "::keptn-status:: first\n::keptn-status:: first\nno status\n::keptn-sta")
+	fmt.Fprint(writer, "tus:: second\n::keptn-status::   \n")
+	for i := 0; i < 2*maxStatusUpdates; i++ {
+		reporter.send(fmt.Sprintf("update %d", i))
+	}
+	reporter.close()
+	reporter.send("after close")
+
+	want := []string{"first", "second"}
+	for i := 0; len(want) < maxStatusUpdates; i++ {
+		want = append(want, fmt.Sprintf("update %d", i))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reported %d updates, want %d: %v", len(got), len(want), got)
+	}
+}
+
+func Test_lineWriterTruncatesLongLines(t *testing.T) {
+	got := []string{}
+	writer := &lineWriter{onLine: func(line string) { got = append(got, line) }}
+
+	// a line without new line must not be kept completely - no matter in how many writes it arrives
+	chunk := strings.Repeat("x", maxLineLength/2+1)
+	for i := 0; i < 10; i++ {
+		fmt.Fprint(writer, chunk)
+	}
+	fmt.Fprint(writer, "still the long line\nnext line\r\nlast")
+	writer.flush()
+
+	want := []string{strings.Repeat("x", maxLineLength) + " ... (line truncated)", "next line", "last"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("passed on %d lines, want %d", len(got), len(want))
+	}
+	if len(writer.partial) != 0 {
+		t.Errorf("kept %d bytes after flush, want 0", len(writer.partial))
+	}
+}
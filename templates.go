@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+)
+
+// httpTemplateExtension marks .http files that are Go templates, e.g: test.triggered.http.tmpl
+const httpTemplateExtension = ".http.tmpl"
+
+// templateNoValue is what text/template renders for fields the event doesn't have
+const templateNoValue = "<no value>"
+
+//
+// Returns true if the file is sent as HTTP request(s) - either a plain .http file or a template
+//
+func isHttpFile(fileName string) bool {
+	return strings.HasSuffix(fileName, ".http") || strings.HasSuffix(fileName, httpTemplateExtension)
+}
+
+//
+// Returns true if a .http file is a Go template: either because of its extension or because it starts with # @template go
+//
+func isHttpTemplate(fileName string, content string) (bool, error) {
+	if strings.HasSuffix(fileName, httpTemplateExtension) {
+		return true, nil
+	}
+	switch engine, ok := parseScriptDirectives(content)["template"]; {
+	case !ok:
+		return false, nil
+	case strings.ToLower(engine) == "go":
+		return true, nil
+	default:
+		return false, fmt.Errorf("Invalid template engine %s: only go is supported", engine)
+	}
+}
+
+//
+// Renders a .http file with Go text/template. The template gets the whole event, its data and labels, the exposed env variables and the time of the event
+// Fields missing in the event are handled like unresolved placeholders: unresolvedPolicy decides whether they are rendered as <no value> with a warning,
+// as empty strings or fail the rendering with an unresolvedPlaceholdersError. Fields passed to default are optional with any policy, e.g:
+//
+// POST {{ .data.labels.webhook | default "https://example.com/hook" }}
+// {"text": {{ printf "%s deployed to %s" .data.service .data.stage | json }}}
+//
+func renderHttpTemplate(name string, content string, incomingEvent cloudevents.Event, serviceEnvVariables []string, unresolvedPolicy string) (string, error) {
+	httpTemplate, err := template.New(name).Funcs(httpTemplateFunctions(newSecretScope(incomingEvent))).Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("Invalid template: %s", err.Error())
+	}
+
+	templateData, err := newHttpTemplateData(incomingEvent, serviceEnvVariables)
+	if err != nil {
+		return "", err
+	}
+
+	rendered := bytes.Buffer{}
+	if err := httpTemplate.Execute(&rendered, templateData); err != nil {
+		return "", fmt.Errorf("Failed to render template: %s", err.Error())
+	}
+	if !strings.Contains(rendered.String(), templateNoValue) {
+		return rendered.String(), nil
+	}
+
+	// missing fields don't fail text/template - but we want to know which ones they were, e.g: {{ .data.deployment.gitcommit }}
+	missing := []string{}
+	collectMissingTemplateFields(httpTemplate.Tree.Root, templateData, &missing)
+	if len(missing) == 0 {
+		// e.g: a field inside of range or with
+		missing = append(missing, templateNoValue)
+	}
+
+	switch unresolvedPolicy {
+	case UnresolvedPlaceholdersError:
+		return "", &unresolvedPlaceholdersError{placeholders: missing}
+	case UnresolvedPlaceholdersEmpty:
+		log.Printf("Replaced fields missing in the event with empty strings: %s", strings.Join(missing, ", "))
+		return strings.Replace(rendered.String(), templateNoValue, "", -1), nil
+	default:
+		log.Printf("Warning: rendering fields missing in the event as %s: %s", templateNoValue, strings.Join(missing, ", "))
+		return rendered.String(), nil
+	}
+}
+
+//
+// Adds the fields a template outputs that aren't in its data, e.g: {{ .data.labels.team }}. Conditions and fields passed to default are optional
+// Inside of range and with the fields are relative to another value - so they aren't checked
+//
+func collectMissingTemplateFields(node parse.Node, data interface{}, missing *[]string) {
+	switch typedNode := node.(type) {
+	case *parse.ListNode:
+		if typedNode == nil {
+			return
+		}
+		for _, child := range typedNode.Nodes {
+			collectMissingTemplateFields(child, data, missing)
+		}
+	case *parse.ActionNode:
+		collectMissingPipeFields(typedNode.Pipe, data, missing)
+	case *parse.IfNode:
+		collectMissingTemplateFields(typedNode.List, data, missing)
+		collectMissingTemplateFields(typedNode.ElseList, data, missing)
+	case *parse.RangeNode:
+		collectMissingTemplateFields(typedNode.ElseList, data, missing)
+	case *parse.WithNode:
+		collectMissingTemplateFields(typedNode.ElseList, data, missing)
+	}
+}
+
+func collectMissingPipeFields(pipe *parse.PipeNode, data interface{}, missing *[]string) {
+	if pipe == nil {
+		return
+	}
+	for _, command := range pipe.Cmds {
+		if identifier, ok := command.Args[0].(*parse.IdentifierNode); ok && identifier.Ident == "default" {
+			return
+		}
+	}
+
+	for _, command := range pipe.Cmds {
+		for _, arg := range command.Args {
+			var path []string
+			switch typedArg := arg.(type) {
+			case *parse.FieldNode:
+				path = typedArg.Ident
+			case *parse.VariableNode:
+				if typedArg.Ident[0] == "$" {
+					path = typedArg.Ident[1:]
+				}
+			case *parse.PipeNode:
+				collectMissingPipeFields(typedArg, data, missing)
+			}
+			if len(path) == 0 || templateFieldExists(data, path) {
+				continue
+			}
+
+			field := "{{ ." + strings.Join(path, ".") + " }}"
+			exists := false
+			for _, known := range *missing {
+				exists = exists || known == field
+			}
+			if !exists {
+				*missing = append(*missing, field)
+			}
+		}
+	}
+}
+
+//
+// Returns false if a field of the template data is missing or null. Fields of values that aren't maps, e.g: .time.Year, are assumed to exist
+//
+func templateFieldExists(data interface{}, path []string) bool {
+	value := reflect.ValueOf(data)
+	for _, key := range path {
+		for value.Kind() == reflect.Interface {
+			value = value.Elem()
+		}
+		if value.Kind() != reflect.Map {
+			return value.IsValid()
+		}
+		value = value.MapIndex(reflect.ValueOf(key))
+		if !value.IsValid() {
+			return false
+		}
+	}
+	for value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	return value.IsValid()
+}
+
+//
+// Returns what a .http template can access: .event, .data, .labels, .env and .time
+//
+func newHttpTemplateData(incomingEvent cloudevents.Event, serviceEnvVariables []string) (map[string]interface{}, error) {
+	// numbers are rendered as they are in the event, e.g: 1000000 instead of 1e+06
+	event, err := decodePlaceholderFields(incomingEvent)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode incomingEvent: %s", err.Error())
+	}
+
+	data, _ := event["data"].(map[string]interface{})
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	labels, _ := data["labels"].(map[string]interface{})
+	if labels == nil {
+		labels = map[string]interface{}{}
+	}
+
+	// only the env variables we are allowed to pass on - see getExposedEnvVariables
+	env := map[string]string{}
+	for _, envVariable := range serviceEnvVariables {
+		pair := strings.SplitN(envVariable, "=", 2)
+		if len(pair) == 2 {
+			env[pair[0]] = pair[1]
+		}
+	}
+
+	return map[string]interface{}{
+		"event":  event,
+		"data":   data,
+		"labels": labels,
+		"env":    env,
+		"time":   incomingEvent.Time().UTC(),
+	}, nil
+}
+
+//
+// Returns the functions available in .http templates. scope decides which secrets they can reference
+//
+func httpTemplateFunctions(scope secretScope) template.FuncMap {
+	return template.FuncMap{
+		"default":    templateDefault,
+		"json":       templateJSON,
+		"urlencode":  url.QueryEscape,
+		"base64":     func(value string) string { return base64.StdEncoding.EncodeToString([]byte(value)) },
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"trim":       strings.TrimSpace,
+		"sha256":     templateSHA256,
+		"now":        func() time.Time { return time.Now().UTC() },
+		"formatTime": templateFormatTime,
+		// e.g: {{ secret "dynatrace" "token" }} - every secret is fetched once per template
+		"secret": newSecretValues(scope).get,
+	}
+}
+
+//
+// Returns value - or defaultValue if value is missing, nil or empty, e.g: {{ .data.labels.team | default "sre" }}
+//
+func templateDefault(defaultValue interface{}, value interface{}) interface{} {
+	if value == nil {
+		return defaultValue
+	}
+	switch reflected := reflect.ValueOf(value); reflected.Kind() {
+	case reflect.String, reflect.Map, reflect.Slice, reflect.Array:
+		if reflected.Len() == 0 {
+			return defaultValue
+		}
+	}
+	return value
+}
+
+//
+// Returns the value as JSON, e.g: a quoted and escaped string to use in a JSON body
+//
+func templateJSON(value interface{}) (string, error) {
+	valueAsJSON, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(valueAsJSON), nil
+}
+
+//
+// Returns the hex encoded SHA-256 hash of a value, e.g: to sign a request
+//
+func templateSHA256(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])
+}
+
+//
+// Formats a time with a Go layout, e.g: {{ formatTime "2006-01-02T15:04:05Z07:00" now }}. Strings are parsed as RFC3339 first, e.g: .event.time
+//
+func templateFormatTime(layout string, value interface{}) (string, error) {
+	switch typedValue := value.(type) {
+	case time.Time:
+		return typedValue.Format(layout), nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, typedValue)
+		if err != nil {
+			return "", err
+		}
+		return parsed.Format(layout), nil
+	default:
+		return "", fmt.Errorf("formatTime expects a time or RFC3339 string but got %T", value)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_renderHttpTemplate(t *testing.T) {
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{
+		"project": "sockshop",
+		"stage":   "staging",
+		"labels":  map[string]interface{}{"owner": "Team \"A\""},
+	})
+	event.SetTime(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC))
+	env := []string{"DT_TENANT=abc.live.dynatrace.com"}
+
+	tests := []struct {
+		name     string
+		template string
+		policy   string
+		want     string
+		wantErr  bool
+	}{
+		{name: "event data", template: `{{ .data.project }}/{{ .event.type }}`, want: "sockshop/sh.keptn.event.test.triggered"},
+		{name: "labels as JSON", template: `{"owner": {{ .labels.owner | json }}}`, want: `{"owner": "Team \"A\""}`},
+		{name: "env", template: `https://{{ .env.DT_TENANT }}/api`, want: "https://abc.live.dynatrace.com/api"},
+		{name: "default", template: `{{ .labels.team | default "sre" }} {{ .data.stage | default "dev" }}`, want: "sre staging"},
+		{name: "conditional", template: `{{ if eq .data.stage "production" }}prod{{ else }}non-prod{{ end }}`, want: "non-prod"},
+		{name: "loop", template: `{{ range $key, $value := .labels }}{{ $key }}={{ urlencode $value }}{{ end }}`, want: "owner=Team+%22A%22"},
+		{name: "string functions", template: `{{ upper .data.project }} {{ base64 "user:pass" }} {{ sha256 "abc" | printf "%.8s" }}`, want: "SOCKSHOP dXNlcjpwYXNz ba7816bf"},
+		{name: "time", template: `{{ formatTime "2006-01-02" .time }} {{ formatTime "15:04" .event.time }}`, want: "2021-03-04 05:06"},
+		{name: "missing field with policy warn", template: `https://e.com/{{ .data.labels.team }}`, policy: UnresolvedPlaceholdersWarn, want: "https://e.com/<no value>"},
+		{name: "missing field with policy empty", template: `https://e.com/{{ .data.labels.team }}{{ $.data.commit }}`, policy: UnresolvedPlaceholdersEmpty, want: "https://e.com/"},
+		{name: "missing field with policy error", template: `{{ .data.labels.team }}`, policy: UnresolvedPlaceholdersError, wantErr: true},
+		{name: "default with policy error", template: `{{ .labels.team | default "sre" }} {{ default "dev" .data.missing }}{{ if .data.missing }}x{{ end }}`, policy: UnresolvedPlaceholdersError, want: "sre dev"},
+		{name: "nested missing field with policy empty", template: `{{ .data.deployment.gitcommit }}`, policy: UnresolvedPlaceholdersEmpty, want: ""},
+		{name: "syntax error", template: `{{ .data.project `, wantErr: true},
+		{name: "unknown function", template: `{{ lowercase .data.project }}`, wantErr: true},
+		{name: "secret without provider", template: `{{ secret "dynatrace" "token" }}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderHttpTemplate("test.triggered.http.tmpl", tt.template, event, env, tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderHttpTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("renderHttpTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseHttpRequestsFromTemplateFile(t *testing.T) {
+	directory, err := ioutil.TempDir("", "generic-executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	files := map[string]string{
+		"extension.http.tmpl": "POST https://example.com/{{ .data.project }}\nContent-Type: application/json\n\n{\"stage\": {{ .data.stage | json }}}\n",
+		"directive.http":      "# @template go\nGET https://example.com/{{ .data.project }}?stage=${data.stage}\n",
+		"plain.http":          "GET https://example.com/${data.project}\n",
+		"invalid.http":        "# @template mustache\nGET https://example.com/\n",
+	}
+	tests := []struct {
+		file    string
+		wantURI string
+		wantErr bool
+	}{
+		{file: "extension.http.tmpl", wantURI: "https://example.com/sockshop"},
+		{file: "directive.http", wantURI: "https://example.com/sockshop?stage=${data.stage}"},
+		{file: "plain.http", wantURI: "https://example.com/sockshop"},
+		{file: "invalid.http", wantErr: true},
+	}
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop", "stage": "staging"})
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			fileName := filepath.Join(directory, tt.file)
+			if err := ioutil.WriteFile(fileName, []byte(files[tt.file]), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			requests, err := parseHttpRequestsFromHttpTextFile(fileName, event, []string{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseHttpRequestsFromHttpTextFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && requests[0].uri != tt.wantURI {
+				t.Errorf("parseHttpRequestsFromHttpTextFile() uri = %s, want %s", requests[0].uri, tt.wantURI)
+			}
+		})
+	}
+}
+
+func Test_renderHttpTemplateListsMissingFields(t *testing.T) {
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": "sockshop"})
+
+	_, err := renderHttpTemplate("test.triggered.http.tmpl", `{{ .data.project }}/{{ .data.stage }}/{{ $.data.labels.team }}/{{ .data.stage }}`, event, []string{}, UnresolvedPlaceholdersError)
+	unresolvedErr, ok := err.(*unresolvedPlaceholdersError)
+	if !ok {
+		t.Fatalf("renderHttpTemplate() error = %v, want unresolvedPlaceholdersError", err)
+	}
+	want := []string{"{{ .data.stage }}", "{{ .data.labels.team }}"}
+	if !reflect.DeepEqual(unresolvedErr.placeholders, want) {
+		t.Errorf("renderHttpTemplate() missing fields = %v, want %v", unresolvedErr.placeholders, want)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2" // make sure to use v2 cloudevents here
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// errQueueFull is returned for events that are rejected because QUEUE_SIZE events are already waiting
+var errQueueFull = errors.New("Queue is full")
+
+// errShuttingDown is returned for events that are received while the service shuts down
+var errShuttingDown = errors.New("Service is shutting down")
+
+// eventJob is a received event waiting to be handled by a worker
+type eventJob struct {
+	myKeptn *keptnv2.Keptn
+	event   cloudevents.Event
+	data    interface{}
+}
+
+// eventHandler handles a single event - GenericCloudEventsHandler outside of tests. ctx is cancelled when the grace period of a shutdown is over
+type eventHandler func(ctx context.Context, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data interface{}) error
+
+// workerPool handles received events asynchronously with a fixed number of workers
+// Events wait in a bounded queue until a worker is free. Events whose project or service is at its limit are parked without holding a worker
+type workerPool struct {
+	jobs            chan eventJob
+	concurrency     int
+	queueFullPolicy string
+	handler         eventHandler
+	running         int64
+
+	// limitsMutex protects the limits and the parked events
+	limitsMutex   sync.Mutex
+	projectLimits *keyedSemaphore
+	serviceLimits *keyedSemaphore
+	// parked are dequeued events that wait for an event of the same project or service to finish
+	parked []eventJob
+
+	// ctx is passed to all handlers and cancelled if they don't finish within the grace period of a shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mutex protects stopping so that no event gets accepted once the shutdown started and pending
+	mutex    sync.Mutex
+	stopping bool
+	// pending counts the accepted events that aren't handled yet - in the queue or parked
+	pending int
+	// room is signalled when an event leaves the queue and when the shutdown starts
+	room *sync.Cond
+	// stopped is closed when the shutdown starts. It ends the wait of events that are handed to a worker without a queue
+	stopped chan struct{}
+	// accepted counts the events that are queued or running
+	accepted sync.WaitGroup
+}
+
+// eventWorkerPool handles all events received by the service
+var eventWorkerPool *workerPool
+
+//
+// Creates a worker pool and starts its workers
+// queueFullPolicy defines what happens if queueSize events are waiting: reject returns errQueueFull, wait blocks until there is room
+// maxPerProject and maxPerService limit how many events of the same project or service are handled at the same time (0 = no limit)
+//
+func newWorkerPool(concurrency int, queueSize int, queueFullPolicy string, maxPerProject int, maxPerService int, handler eventHandler) (*workerPool, error) {
+	if concurrency < 1 {
+		return nil, fmt.Errorf("Invalid concurrency %d: must be at least 1", concurrency)
+	}
+	if queueSize < 0 {
+		return nil, fmt.Errorf("Invalid queue size %d: must be >= 0", queueSize)
+	}
+	queueFullPolicy = strings.ToLower(queueFullPolicy)
+	if queueFullPolicy != "reject" && queueFullPolicy != "wait" {
+		return nil, fmt.Errorf("Invalid queue full policy %s: must be reject or wait", queueFullPolicy)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := &workerPool{
+		jobs:            make(chan eventJob, queueSize),
+		concurrency:     concurrency,
+		queueFullPolicy: queueFullPolicy,
+		projectLimits:   newKeyedSemaphore(maxPerProject),
+		serviceLimits:   newKeyedSemaphore(maxPerService),
+		handler:         handler,
+		ctx:             ctx,
+		cancel:          cancel,
+		stopped:         make(chan struct{}),
+	}
+	pool.room = sync.NewCond(&pool.mutex)
+	for i := 0; i < concurrency; i++ {
+		go pool.work()
+	}
+	return pool, nil
+}
+
+//
+// Adds an event to the queue. Returns errQueueFull if the queue is full and the policy is reject and errShuttingDown after shutdown was called
+//
+func (p *workerPool) enqueue(job eventJob) error {
+	p.mutex.Lock()
+
+	// parked events still count towards the size of the queue
+	for !p.stopping && cap(p.jobs) > 0 && p.pending >= cap(p.jobs) {
+		if p.queueFullPolicy == "reject" {
+			p.mutex.Unlock()
+			return errQueueFull
+		}
+		// a full queue can take as long as a script to have room again - Wait releases the mutex so that shutdown doesn't have to wait for it
+		p.room.Wait()
+	}
+	if p.stopping {
+		p.mutex.Unlock()
+		return errShuttingDown
+	}
+	// the event is accepted before the shutdown started - so shutdown waits for it until it is either handled or given up
+	p.accepted.Add(1)
+	p.pending++
+	p.mutex.Unlock()
+
+	// with a queue there is room for every pending event, so sending doesn't block. Without a queue the event is handed to a free worker
+	if cap(p.jobs) == 0 && p.queueFullPolicy == "reject" {
+		select {
+		case p.jobs <- job:
+			return nil
+		default:
+			p.giveUp()
+			return errQueueFull
+		}
+	}
+	select {
+	case p.jobs <- job:
+		return nil
+	case <-p.stopped:
+		p.giveUp()
+		return errShuttingDown
+	}
+}
+
+//
+// Removes an event from the pending events once it gets handled
+//
+func (p *workerPool) dequeued() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.pending--
+	p.room.Signal()
+}
+
+func (p *workerPool) giveUp() {
+	p.dequeued()
+	p.accepted.Done()
+}
+
+//
+// Stops accepting events and waits for all queued and running events. Events that are not done within the grace period get cancelled
+// Returns false if events had to be cancelled
+//
+func (p *workerPool) shutdown(gracePeriod time.Duration) bool {
+	p.mutex.Lock()
+	p.stopping = true
+	close(p.stopped)
+	p.room.Broadcast()
+	p.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.accepted.Wait()
+		close(done)
+	}()
+
+	queued, running := p.stats()
+	log.Printf("Waiting up to %s for %d queued and %d running events", gracePeriod.String(), queued, running)
+
+	select {
+	case <-done:
+		p.cancel()
+		return true
+	case <-time.After(gracePeriod):
+	}
+
+	queued, running = p.stats()
+	log.Printf("Grace period of %s is over - cancelling %d queued and %d running events", gracePeriod.String(), queued, running)
+	p.cancel()
+	// cancelled scripts get killed and cancelled requests return immediately - so this only takes as long as sending the finished events
+	<-done
+	return false
+}
+
+//
+// Returns the number of events waiting in the queue or parked and the number of events that are currently handled
+//
+func (p *workerPool) stats() (int, int) {
+	return p.queued(), int(atomic.LoadInt64(&p.running))
+}
+
+func (p *workerPool) queued() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.pending
+}
+
+//
+// Returns true if events have to wait or get rejected because the queue is full
+//
+func (p *workerPool) isFull() bool {
+	queued, running := p.stats()
+	if cap(p.jobs) == 0 {
+		// without a queue events are only accepted by a free worker
+		return running >= p.concurrency
+	}
+	return queued >= cap(p.jobs)
+}
+
+func (p *workerPool) work() {
+	for job := range p.jobs {
+		if !p.start(job) {
+			// the worker is free for events of other projects and services - the event is handled once its project and service are below their limits
+			continue
+		}
+		for next := &job; next != nil; next = p.finish(*next) {
+			p.handle(*next)
+		}
+	}
+}
+
+func limitKeys(job eventJob) (string, string) {
+	project := job.myKeptn.Event.GetProject()
+	return project, project + "/" + job.myKeptn.Event.GetService()
+}
+
+//
+// Takes the limits of the project and service of an event. Returns false and parks the event if one of them is reached
+//
+func (p *workerPool) start(job eventJob) bool {
+	p.limitsMutex.Lock()
+	defer p.limitsMutex.Unlock()
+
+	if !p.tryAcquire(job) {
+		p.parked = append(p.parked, job)
+		return false
+	}
+	return true
+}
+
+//
+// Releases the limits of a handled event and returns the first parked event that can be handled now - nil if there is none
+//
+func (p *workerPool) finish(job eventJob) *eventJob {
+	p.limitsMutex.Lock()
+	defer p.limitsMutex.Unlock()
+
+	project, service := limitKeys(job)
+	p.projectLimits.release(project)
+	p.serviceLimits.release(service)
+
+	for ix, parked := range p.parked {
+		if p.tryAcquire(parked) {
+			p.parked = append(p.parked[:ix], p.parked[ix+1:]...)
+			return &parked
+		}
+	}
+	return nil
+}
+
+func (p *workerPool) tryAcquire(job eventJob) bool {
+	project, service := limitKeys(job)
+	if !p.projectLimits.available(project) || !p.serviceLimits.available(service) {
+		return false
+	}
+	p.projectLimits.acquire(project)
+	p.serviceLimits.acquire(service)
+	return true
+}
+
+func (p *workerPool) handle(job eventJob) {
+	p.dequeued()
+	defer p.accepted.Done()
+
+	atomic.AddInt64(&p.running, 1)
+	defer atomic.AddInt64(&p.running, -1)
+
+	defer func() {
+		// a panic in one handler must neither kill the service nor leave the task without a finished event
+		if r := recover(); r != nil {
+			log.Printf("Handling event %s panicked: %v", job.event.ID(), r)
+			if _, err := keptnv2.GetEventTypeForTriggeredEvent(job.event.Type(), ""); err == nil {
+				sendTaskFinishedEvent(job.myKeptn, &keptnv2.EventData{
+					Status:  keptnv2.StatusErrored,
+					Result:  keptnv2.ResultFailed,
+					Message: fmt.Sprintf("Failed to handle event: %v", r),
+				})
+			}
+		}
+	}()
+
+	if err := p.handler(p.ctx, job.myKeptn, job.event, job.data); err != nil {
+		log.Printf("Failed to handle event %s: %s", job.event.ID(), err.Error())
+	}
+}
+
+// keyedSemaphore counts how many holders of the same key (e.g: project) run at the same time. It is protected by the limitsMutex of the workerPool
+type keyedSemaphore struct {
+	limit   int
+	holders map[string]int
+}
+
+//
+// Creates a keyedSemaphore. A limit of 0 means no limit
+//
+func newKeyedSemaphore(limit int) *keyedSemaphore {
+	return &keyedSemaphore{limit: limit, holders: map[string]int{}}
+}
+
+func (s *keyedSemaphore) available(key string) bool {
+	return s.limit <= 0 || s.holders[key] < s.limit
+}
+
+func (s *keyedSemaphore) acquire(key string) {
+	s.holders[key]++
+}
+
+func (s *keyedSemaphore) release(key string) {
+	if s.holders[key]--; s.holders[key] <= 0 {
+		delete(s.holders, key)
+	}
+}
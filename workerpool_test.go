@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2"
+	keptn "github.com/keptn/go-utils/pkg/lib/keptn"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func newTestEventJob(t *testing.T, project string, service string) eventJob {
+	event := newTestEvent("sh.keptn.event.test.triggered", map[string]interface{}{"project": project, "stage": "dev", "service": service})
+	myKeptn, err := keptnv2.NewKeptn(&event, keptn.KeptnOpts{UseLocalFileSystem: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return eventJob{myKeptn: myKeptn, event: event}
+}
+
+func Test_workerPoolLimits(t *testing.T) {
+	tests := []struct {
+		name          string
+		concurrency   int
+		maxPerService int
+		services      []string
+		wantMax       int64
+	}{
+		{name: "max concurrency", concurrency: 2, services: []string{"a", "b", "c", "d"}, wantMax: 2},
+		{name: "max per service", concurrency: 4, maxPerService: 1, services: []string{"a", "a", "a", "a"}, wantMax: 1},
+		{name: "different services", concurrency: 4, maxPerService: 1, services: []string{"a", "b", "a", "b"}, wantMax: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var running, maxRunning int64
+			var wg sync.WaitGroup
+			handler := func(ctx context.Context, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data interface{}) error {
+				defer wg.Done()
+				current := atomic.AddInt64(&running, 1)
+				for {
+					max := atomic.LoadInt64(&maxRunning)
+					if current <= max || atomic.CompareAndSwapInt64(&maxRunning, max, current) {
+						break
+					}
+				}
+				time.Sleep(50 * time.Millisecond)
+				atomic.AddInt64(&running, -1)
+				return nil
+			}
+
+			pool, err := newWorkerPool(tt.concurrency, 10, "reject", 0, tt.maxPerService, handler)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, service := range tt.services {
+				wg.Add(1)
+				if err := pool.enqueue(newTestEventJob(t, "project", service)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			wg.Wait()
+
+			if maxRunning != tt.wantMax {
+				t.Errorf("max running events = %d, want %d", maxRunning, tt.wantMax)
+			}
+		})
+	}
+}
+
+func Test_workerPoolParksEventsAtTheirLimit(t *testing.T) {
+	block := make(chan struct{})
+	started := make(chan string, 10)
+	handler := func(ctx context.Context, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data interface{}) error {
+		service := myKeptn.Event.GetService()
+		started <- service
+		if service == "slow" {
+			<-block
+		}
+		return nil
+	}
+
+	pool, err := newWorkerPool(2, 10, "reject", 0, 1, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range []string{"slow", "slow", "slow", "fast"} {
+		if err := pool.enqueue(newTestEventJob(t, "project", service)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the events of slow that are at the limit must not keep the second worker from handling fast
+	for _, want := range []string{"slow", "fast"} {
+		select {
+		case service := <-started:
+			if service != want {
+				t.Fatalf("started %s, want %s", service, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s wasn't started", want)
+		}
+	}
+	// fast might still be running
+	deadline := time.Now().Add(time.Second)
+	queued, running := pool.stats()
+	for ; running > 1 && time.Now().Before(deadline); queued, running = pool.stats() {
+		time.Sleep(time.Millisecond)
+	}
+	if queued != 2 || running != 1 {
+		t.Errorf("stats() = %d queued and %d running, want 2 queued and 1 running", queued, running)
+	}
+
+	close(block)
+	if !pool.shutdown(time.Second) {
+		t.Error("shutdown() = false, want the parked events to be handled")
+	}
+	if len(started) != 2 {
+		t.Errorf("started %d more events, want the 2 parked ones", len(started))
+	}
+}
+
+func Test_workerPoolRejectsWhenQueueIsFull(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	handler := func(ctx context.Context, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data interface{}) error {
+		<-block
+		return nil
+	}
+
+	pool, err := newWorkerPool(1, 1, "reject", 0, 0, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := newTestEventJob(t, "project", "service")
+
+	// the first event is handled, the second waits in the queue
+	pool.enqueue(job)
+	for queued, running := pool.stats(); queued > 0 || running == 0; queued, running = pool.stats() {
+		time.Sleep(time.Millisecond)
+	}
+	if err := pool.enqueue(job); err != nil {
+		t.Fatalf("enqueue() error = %v", err)
+	}
+	if err := pool.enqueue(job); err != errQueueFull {
+		t.Errorf("enqueue() error = %v, want %v", err, errQueueFull)
+	}
+}
+
+func Test_workerPoolShutdown(t *testing.T) {
+	tests := []struct {
+		name         string
+		duration     time.Duration
+		gracePeriod  time.Duration
+		wantFinished bool
+	}{
+		{name: "events finish within grace period", duration: 50 * time.Millisecond, gracePeriod: time.Second, wantFinished: true},
+		{name: "events are cancelled after grace period", duration: time.Minute, gracePeriod: 50 * time.Millisecond, wantFinished: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled, cancelled int64
+			handler := func(ctx context.Context, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data interface{}) error {
+				select {
+				case <-time.After(tt.duration):
+					atomic.AddInt64(&handled, 1)
+				case <-ctx.Done():
+					atomic.AddInt64(&cancelled, 1)
+				}
+				return nil
+			}
+
+			pool, err := newWorkerPool(1, 10, "wait", 0, 0, handler)
+			if err != nil {
+				t.Fatal(err)
+			}
+			job := newTestEventJob(t, "project", "service")
+			pool.enqueue(job)
+			pool.enqueue(job)
+
+			if finished := pool.shutdown(tt.gracePeriod); finished != tt.wantFinished {
+				t.Errorf("shutdown() = %v, want %v", finished, tt.wantFinished)
+			}
+			// every accepted event was handled - either completely or cancelled
+			if handled+cancelled != 2 {
+				t.Errorf("handled %d and cancelled %d events, want 2 in total", handled, cancelled)
+			}
+			if err := pool.enqueue(job); err != errShuttingDown {
+				t.Errorf("enqueue() after shutdown error = %v, want %v", err, errShuttingDown)
+			}
+		})
+	}
+}
+
+func Test_workerPoolShutdownWhileEnqueueWaits(t *testing.T) {
+	handler := func(ctx context.Context, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data interface{}) error {
+		select {
+		case <-time.After(time.Minute):
+		case <-ctx.Done():
+		}
+		return nil
+	}
+
+	pool, err := newWorkerPool(1, 1, "wait", 0, 0, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := newTestEventJob(t, "project", "service")
+
+	// the first event is handled, the second waits in the queue and the third waits for room in the queue
+	pool.enqueue(job)
+	for queued, running := pool.stats(); queued > 0 || running == 0; queued, running = pool.stats() {
+		time.Sleep(time.Millisecond)
+	}
+	pool.enqueue(job)
+	enqueued := make(chan error)
+	go func() {
+		enqueued <- pool.enqueue(job)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	shutdown := make(chan bool)
+	go func() {
+		shutdown <- pool.shutdown(100 * time.Millisecond)
+	}()
+
+	select {
+	case err := <-enqueued:
+		if err != errShuttingDown {
+			t.Errorf("enqueue() error = %v, want %v", err, errShuttingDown)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("enqueue() still waits for room after shutdown started")
+	}
+	select {
+	case finished := <-shutdown:
+		if finished {
+			t.Error("shutdown() = true, want the running events to be cancelled")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown() didn't cancel the running events after the grace period")
+	}
+}
+
+func Test_workerPoolWaitsWhenParkedEventsFillTheQueue(t *testing.T) {
+	block := make(chan struct{})
+	handler := func(ctx context.Context, myKeptn *keptnv2.Keptn, incomingEvent cloudevents.Event, data interface{}) error {
+		<-block
+		return nil
+	}
+
+	pool, err := newWorkerPool(4, 2, "wait", 1, 0, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := newTestEventJob(t, "project", "service")
+
+	// one event is handled, the others of the same project are parked until the queue is full
+	var enqueued int64
+	for i := 0; i < 10; i++ {
+		go func() {
+			if err := pool.enqueue(job); err == nil {
+				atomic.AddInt64(&enqueued, 1)
+			}
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if queued, running := pool.stats(); queued != 2 || running != 1 {
+		t.Errorf("stats() = %d queued and %d running, want 2 queued and 1 running", queued, running)
+	}
+	if got := atomic.LoadInt64(&enqueued); got != 3 {
+		t.Errorf("enqueued %d events, want 3", got)
+	}
+	if !pool.isFull() {
+		t.Error("isFull() = false, want true")
+	}
+
+	close(block)
+	if !pool.shutdown(time.Second) {
+		t.Error("shutdown() = false, want all events to be handled")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+// WorkspaceDirectory is where the workspaces of events are created. Empty for the default directory for temporary files
+var WorkspaceDirectory string
+
+// KeepWorkspaceOnFailure keeps the workspace of an event if a script or request failed so that it can be inspected
+var KeepWorkspaceOnFailure = false
+
+// unsafeWorkspaceNameCharacters are removed from event IDs before they become part of a directory name
+var unsafeWorkspaceNameCharacters = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// workspace is the temporary directory of one event. It contains the fetched resources, the event file and everything the scripts write
+type workspace struct {
+	directory string
+	failed    bool
+}
+
+//
+// Creates an empty workspace for an event, e.g: /tmp/generic-executor-EVENTID-123456
+//
+func newWorkspace(eventID string) (*workspace, error) {
+	directory, err := ioutil.TempDir(WorkspaceDirectory, "generic-executor-"+unsafeWorkspaceNameCharacters.ReplaceAllString(eventID, "")+"-")
+	if err != nil {
+		return nil, err
+	}
+	return &workspace{directory: directory}, nil
+}
+
+//
+// Remembers if a script or request failed - then the workspace is kept with KEEP_WORKSPACE_ON_FAILURE
+//
+func (w *workspace) recordResult(result keptnv2.ResultType, status keptnv2.StatusType) {
+	if result == keptnv2.ResultFailed || status == keptnv2.StatusErrored {
+		w.failed = true
+	}
+}
+
+//
+// Removes the workspace with everything in it - unless something failed and KEEP_WORKSPACE_ON_FAILURE is set
+//
+func (w *workspace) remove() {
+	if w.failed && KeepWorkspaceOnFailure {
+		log.Printf("Keeping workspace %s of failed execution", w.directory)
+		return
+	}
+	if err := os.RemoveAll(w.directory); err != nil {
+		log.Printf("Failed to remove workspace %s: %s", w.directory, err.Error())
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+)
+
+func Test_workspace(t *testing.T) {
+	defer func(directory string, keep bool) {
+		WorkspaceDirectory, KeepWorkspaceOnFailure = directory, keep
+	}(WorkspaceDirectory, KeepWorkspaceOnFailure)
+
+	base, err := ioutil.TempDir("", "workspaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+	WorkspaceDirectory = base
+
+	tests := []struct {
+		name     string
+		keep     bool
+		result   keptnv2.ResultType
+		status   keptnv2.StatusType
+		wantKept bool
+	}{
+		{name: "removed after success", keep: true, result: keptnv2.ResultPass, status: keptnv2.StatusSucceeded},
+		{name: "removed after failure", result: keptnv2.ResultFailed, status: keptnv2.StatusSucceeded},
+		{name: "kept after failure", keep: true, result: keptnv2.ResultFailed, status: keptnv2.StatusSucceeded, wantKept: true},
+		{name: "kept after error", keep: true, result: keptnv2.ResultWarning, status: keptnv2.StatusErrored, wantKept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			KeepWorkspaceOnFailure = tt.keep
+
+			eventWorkspace, err := newWorkspace("../3a455fb7-7e48")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filepath.Dir(eventWorkspace.directory) != base || !strings.HasPrefix(filepath.Base(eventWorkspace.directory), "generic-executor-3a455fb7-7e48-") {
+				t.Fatalf("newWorkspace() = %s", eventWorkspace.directory)
+			}
+			if _, err := storeKeptnResource(eventWorkspace.directory+"/generic-executor/test.triggered.sh", "echo test"); err != nil {
+				t.Fatal(err)
+			}
+
+			eventWorkspace.recordResult(tt.result, tt.status)
+			eventWorkspace.remove()
+
+			_, err = os.Stat(eventWorkspace.directory)
+			if kept := err == nil; kept != tt.wantKept {
+				t.Errorf("workspace kept = %t, want %t", kept, tt.wantKept)
+			}
+		})
+	}
+}